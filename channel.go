@@ -0,0 +1,204 @@
+package tinter
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// defaultChannelBuffer is the default capacity of the channel of
+// [NewChannelHandler]
+const defaultChannelBuffer = 64
+
+// ChannelPolicy controls what a [ChannelHandler] does when its channel is
+// full, see ChannelOptions.Policy.
+type ChannelPolicy int
+
+const (
+	// ChannelDrop drops records if the channel is full, counting them, see
+	// [ChannelHandler.Dropped].
+	ChannelDrop ChannelPolicy = iota
+
+	// ChannelBlock blocks until the record is received or the context of the
+	// record is done.
+	ChannelBlock
+)
+
+// ChannelOptions are options for a [ChannelHandler].
+type ChannelOptions struct {
+	// Minimum level to log (Default: slog.LevelInfo)
+	Level slog.Leveler
+
+	// ReplaceAttr is called to rewrite the time, level, message and each
+	// non-group attribute before it is sent, like for [slog.HandlerOptions].
+	// The time, level and message are dropped if ReplaceAttr returns an
+	// attribute with an empty key, or kept if it returns a value of another
+	// type.
+	ReplaceAttr func(groups []string, attr slog.Attr) slog.Attr
+
+	// Capacity of the channel (Default: 64)
+	Buffer int
+
+	// Behavior if the channel is full (Default: ChannelDrop)
+	Policy ChannelPolicy
+}
+
+// Record is a log record sent by a [ChannelHandler].
+type Record struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+
+	// Handler and record attributes, resolved and with ReplaceAttr applied.
+	// Groups are flattened into fully-qualified keys, e.g. "http.status".
+	Attrs []slog.Attr
+}
+
+// ChannelHandler is a [slog.Handler] that sends records on a channel instead
+// of formatting them, e.g. to consume them in tests or a TUI.
+type ChannelHandler struct {
+	attrs  []slog.Attr
+	groups []string
+
+	ch          chan Record
+	dropped     *atomic.Int64 // shared with derived handlers
+	level       slog.Leveler
+	replaceAttr func([]string, slog.Attr) slog.Attr
+	block       bool
+}
+
+// NewChannelHandler creates a [ChannelHandler] and returns it with the channel
+// it sends records on. If opts is nil, the default options are used.
+func NewChannelHandler(opts *ChannelOptions) (*ChannelHandler, <-chan Record) {
+	h := &ChannelHandler{
+		dropped: new(atomic.Int64),
+		level:   defaultLevel,
+	}
+	size := defaultChannelBuffer
+	if opts != nil {
+		if opts.Level != nil {
+			h.level = opts.Level
+		}
+		h.replaceAttr = opts.ReplaceAttr
+		h.block = opts.Policy == ChannelBlock
+		if opts.Buffer > 0 {
+			size = opts.Buffer
+		}
+	}
+	h.ch = make(chan Record, size)
+	return h, h.ch
+}
+
+// Dropped returns the number of records dropped because the channel was full,
+// including those of derived handlers
+func (h *ChannelHandler) Dropped() int64 {
+	return h.dropped.Load()
+}
+
+// Enabled returns true if the level is enabled
+func (h *ChannelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle sends a log record on the channel
+func (h *ChannelHandler) Handle(ctx context.Context, r slog.Record) error {
+	rec := Record{
+		Time:    r.Time,
+		Level:   r.Level,
+		Message: r.Message,
+		Attrs:   make([]slog.Attr, len(h.attrs), len(h.attrs)+r.NumAttrs()),
+	}
+	if rep := h.replaceAttr; rep != nil {
+		if !r.Time.IsZero() {
+			a := rep(nil /* groups */, slog.Time(slog.TimeKey, r.Time.Round(0)))
+			if a.Key == "" {
+				rec.Time = time.Time{}
+			} else if a.Value.Kind() == slog.KindTime {
+				rec.Time = a.Value.Time()
+			}
+		}
+		if a := rep(nil /* groups */, slog.Any(slog.LevelKey, r.Level)); a.Key != "" {
+			if level, ok := a.Value.Any().(slog.Level); ok {
+				rec.Level = level
+			}
+		}
+		if a := rep(nil /* groups */, slog.String(slog.MessageKey, r.Message)); a.Key == "" {
+			rec.Message = ""
+		} else {
+			rec.Message = a.Value.String()
+		}
+	}
+
+	copy(rec.Attrs, h.attrs)
+	r.Attrs(func(attr slog.Attr) bool {
+		rec.Attrs = h.appendAttr(rec.Attrs, attr, h.groups)
+		return true
+	})
+
+	if h.block {
+		select {
+		case h.ch <- rec:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	select {
+	case h.ch <- rec:
+	default:
+		h.dropped.Add(1)
+	}
+	return nil
+}
+
+// WithAttrs returns a new handler with the given attributes
+func (h *ChannelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = h.attrs[:len(h.attrs):len(h.attrs)]
+	for _, attr := range attrs {
+		h2.attrs = h.appendAttr(h2.attrs, attr, h.groups)
+	}
+	return &h2
+}
+
+// WithGroup returns a new handler with the given group name
+func (h *ChannelHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &h2
+}
+
+// appendAttr appends the resolved attribute to attrs, flattening groups into
+// fully-qualified keys
+func (h *ChannelHandler) appendAttr(attrs []slog.Attr, attr slog.Attr, groups []string) []slog.Attr {
+	attr.Value = attr.Value.Resolve()
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], attr.Key)
+		}
+		for _, groupAttr := range attr.Value.Group() {
+			attrs = h.appendAttr(attrs, groupAttr, groups)
+		}
+		return attrs
+	}
+
+	if h.replaceAttr != nil {
+		attr = h.replaceAttr(groups, attr)
+		attr.Value = attr.Value.Resolve()
+	}
+	if attr.Equal(slog.Attr{}) {
+		return attrs
+	}
+	if len(groups) > 0 {
+		attr.Key = strings.Join(groups, ".") + "." + attr.Key
+	}
+	return append(attrs, attr)
+}
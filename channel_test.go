@@ -0,0 +1,78 @@
+package tinter
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestChannelHandler(t *testing.T) {
+	h, records := NewChannelHandler(&ChannelOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == "secret" || a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			if a.Key == slog.MessageKey {
+				return slog.String(a.Key, "msg: "+a.Value.String())
+			}
+			return a
+		},
+	})
+	l := slog.New(h)
+
+	l.Debug("disabled")
+	l.With("a", 1).WithGroup("g").Info("test", "b", "x", "secret", "y", slog.Group("h", "c", true))
+
+	rec := <-records
+	if rec.Level != slog.LevelInfo || rec.Message != "msg: test" || !rec.Time.IsZero() {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	want := []slog.Attr{slog.Int("a", 1), slog.String("g.b", "x"), slog.Bool("g.h.c", true)}
+	if len(rec.Attrs) != len(want) {
+		t.Fatalf("want %v, got %v", want, rec.Attrs)
+	}
+	for i := range want {
+		if !want[i].Equal(rec.Attrs[i]) {
+			t.Fatalf("want %v, got %v", want, rec.Attrs)
+		}
+	}
+
+	select {
+	case rec := <-records:
+		t.Fatalf("unexpected record %+v", rec)
+	default:
+	}
+}
+
+func TestChannelHandlerPolicy(t *testing.T) {
+	h, records := NewChannelHandler(&ChannelOptions{Buffer: 1})
+	l := slog.New(h)
+	l.Info("first")
+	l.Info("dropped")
+	l.With("a", 1).Info("dropped")
+	if rec := <-records; rec.Message != "first" {
+		t.Fatalf("want first record, got %q", rec.Message)
+	}
+	if len(records) != 0 {
+		t.Fatal("want second record dropped")
+	}
+	if n := h.Dropped(); n != 2 {
+		t.Fatalf("want 2 dropped records, got %d", n)
+	}
+
+	h, records = NewChannelHandler(&ChannelOptions{Buffer: 1, Policy: ChannelBlock})
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, "test", 0)
+	if err := h.Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.Handle(ctx, r); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want blocked until canceled, got %v", err)
+	}
+	if len(records) != 1 || h.Dropped() != 0 {
+		t.Fatalf("want 1 record and none dropped, got %d and %d", len(records), h.Dropped())
+	}
+}
@@ -0,0 +1,241 @@
+package tinter
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ColorProfile describes the color capabilities of a terminal. Color escapes
+// that exceed the capabilities of a profile are downgraded to the closest
+// color the profile supports.
+type ColorProfile int
+
+const (
+	// ProfileTrueColor supports 24-bit colors. Escapes are written as is.
+	ProfileTrueColor ColorProfile = iota
+
+	// ProfileANSI256 supports the 256-color palette. 24-bit colors are mapped
+	// to the 6x6x6 color cube of the palette.
+	ProfileANSI256
+
+	// ProfileANSI16 supports the 16 basic colors. Extended colors are mapped to
+	// the nearest basic color, see [ansi16Colors].
+	ProfileANSI16
+
+	// ProfileNoColor supports no colors at all, equivalent to Options.NoColor.
+	ProfileNoColor
+)
+
+// DetectColorProfile detects the color profile of the terminal f is connected
+// to. It returns ProfileNoColor if f is not a terminal or the NO_COLOR
+// environment variable is set, and otherwise inspects the COLORTERM and TERM
+// environment variables.
+func DetectColorProfile(f *os.File) ColorProfile {
+	if os.Getenv("NO_COLOR") != "" || !isTerminal(f) {
+		return ProfileNoColor
+	}
+
+	term := os.Getenv("TERM")
+	switch {
+	case term == "dumb":
+		return ProfileNoColor
+	case os.Getenv("COLORTERM") == "truecolor" || os.Getenv("COLORTERM") == "24bit":
+		return ProfileTrueColor
+	case strings.Contains(term, "256color"):
+		return ProfileANSI256
+	default:
+		return ProfileANSI16
+	}
+}
+
+// isTerminal returns true if f is a terminal
+func isTerminal(f *os.File) bool {
+	return f != nil && isatty(f)
+}
+
+// convert returns the ANSI escape sequence esc downgraded to the profile. Escape
+// sequences that are not SGR sequences are returned unchanged.
+func (p ColorProfile) convert(esc string) string {
+	if p == ProfileTrueColor || p == ProfileNoColor {
+		return esc
+	}
+	params, ok := strings.CutPrefix(esc, "\033[")
+	if !ok {
+		return esc
+	}
+	params, ok = strings.CutSuffix(params, "m")
+	if !ok {
+		return esc
+	}
+
+	parts := strings.Split(params, ";")
+	out := make([]string, 0, len(parts))
+	for i := 0; i < len(parts); i++ {
+		if (parts[i] != "38" && parts[i] != "48") || i+1 >= len(parts) {
+			out = append(out, parts[i])
+			continue
+		}
+
+		switch {
+		case parts[i+1] == "2" && i+4 < len(parts): // 24-bit color
+			r, g, b := parseUint8(parts[i+2]), parseUint8(parts[i+3]), parseUint8(parts[i+4])
+			if p == ProfileANSI256 {
+				out = append(out, parts[i], "5", strconv.Itoa(rgbTo256(r, g, b)))
+			} else {
+				out = append(out, strconv.Itoa(rgbTo16(r, g, b, parts[i] == "48")))
+			}
+			i += 4
+		case parts[i+1] == "5" && i+2 < len(parts): // 256-color
+			if p == ProfileANSI256 {
+				out = append(out, parts[i:i+3]...)
+			} else {
+				r, g, b := ansi256ToRGB(parseUint8(parts[i+2]))
+				out = append(out, strconv.Itoa(rgbTo16(r, g, b, parts[i] == "48")))
+			}
+			i += 2
+		default:
+			out = append(out, parts[i])
+		}
+	}
+
+	if len(out) == 0 {
+		return ""
+	}
+	return "\033[" + strings.Join(out, ";") + "m"
+}
+
+// rgbTo256 returns the closest color of the 6x6x6 color cube of the 256-color
+// palette
+func rgbTo256(r, g, b uint8) int {
+	q := func(v uint8) int { return (int(v) + 25) / 51 }
+	return 16 + 36*q(r) + 6*q(g) + q(b)
+}
+
+// ansi16Colors maps the 16 basic colors to their RGB values, using the xterm
+// defaults. The index of a color is its offset to the SGR foreground code 30
+// for the colors 0-7 and 90 for the bright colors 8-15:
+//
+//	0 black    (  0,   0,   0)    8 bright black   (127, 127, 127)
+//	1 red      (205,   0,   0)    9 bright red     (255,   0,   0)
+//	2 green    (  0, 205,   0)   10 bright green   (  0, 255,   0)
+//	3 yellow   (205, 205,   0)   11 bright yellow  (255, 255,   0)
+//	4 blue     (  0,   0, 238)   12 bright blue    ( 92,  92, 255)
+//	5 magenta  (205,   0, 205)   13 bright magenta (255,   0, 255)
+//	6 cyan     (  0, 205, 205)   14 bright cyan    (  0, 255, 255)
+//	7 white    (229, 229, 229)   15 bright white   (255, 255, 255)
+var ansi16Colors = [16][3]uint8{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// rgbTo16 returns the SGR code of the basic color nearest to the RGB color, by
+// euclidean distance. If bg is true, the background code is returned.
+func rgbTo16(r, g, b uint8, bg bool) int {
+	best, bestDist := 0, -1
+	for i, c := range ansi16Colors {
+		dr, dg, db := int(r)-int(c[0]), int(g)-int(c[1]), int(b)-int(c[2])
+		if dist := dr*dr + dg*dg + db*db; bestDist < 0 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+
+	code := 30 + best
+	if best >= 8 {
+		code = 90 + best - 8
+	}
+	if bg {
+		code += 10
+	}
+	return code
+}
+
+// ansi256ToRGB returns the RGB value of a color of the 256-color palette
+func ansi256ToRGB(n uint8) (r, g, b uint8) {
+	switch {
+	case n < 16:
+		c := ansi16Colors[n]
+		return c[0], c[1], c[2]
+	case n < 232:
+		levels := [6]uint8{0, 95, 135, 175, 215, 255}
+		n -= 16
+		return levels[n/36], levels[n/6%6], levels[n%6]
+	default:
+		v := 8 + 10*(n-232)
+		return v, v, v
+	}
+}
+
+// parseUint8 parses s as a color component, clamping it to [0, 255]
+func parseUint8(s string) uint8 {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0
+	}
+	if n > 255 {
+		return 255
+	}
+	return uint8(n)
+}
+
+// RGB is a 24-bit color.
+type RGB struct {
+	R, G, B uint8
+}
+
+// escape returns the ANSI escape sequence setting the foreground color to c
+func (c RGB) escape() string {
+	return "\033[38;2;" + strconv.Itoa(int(c.R)) + ";" + strconv.Itoa(int(c.G)) + ";" + strconv.Itoa(int(c.B)) + "m"
+}
+
+// Theme holds the 24-bit colors of the builtin fields, see Options.TrueColor.
+type Theme struct {
+	Time RGB
+
+	Debug RGB
+	Info  RGB
+	Warn  RGB
+	Error RGB
+
+	Key   RGB
+	Value RGB
+
+	ErrorKey   RGB // Key of error attributes
+	ErrorValue RGB // Value of error attributes
+}
+
+// DefaultTheme returns the default 24-bit theme, resembling the default colors.
+func DefaultTheme() *Theme {
+	return &Theme{
+		Time:       RGB{128, 128, 128},
+		Debug:      RGB{198, 120, 221},
+		Info:       RGB{98, 209, 121},
+		Warn:       RGB{229, 192, 86},
+		Error:      RGB{240, 82, 82},
+		Key:        RGB{128, 128, 128},
+		Value:      RGB{220, 220, 220},
+		ErrorKey:   RGB{176, 84, 84},
+		ErrorValue: RGB{240, 82, 82},
+	}
+}
+
+// colors returns c with its empty fields set to the colors of the theme
+func (t *Theme) colors(c Colors) Colors {
+	def := func(color *string, rgb RGB) {
+		if *color == "" {
+			*color = rgb.escape()
+		}
+	}
+	def(&c.Time, t.Time)
+	def(&c.Debug, t.Debug)
+	def(&c.Info, t.Info)
+	def(&c.Warn, t.Warn)
+	def(&c.Error, t.Error)
+	def(&c.Key, t.Key)
+	def(&c.Value, t.Value)
+	def(&c.ErrorKey, t.ErrorKey)
+	def(&c.ErrorValue, t.ErrorValue)
+	return c
+}
@@ -0,0 +1,158 @@
+package tinter
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestColorProfileConvert(t *testing.T) {
+	tests := []struct {
+		Profile ColorProfile
+		Esc     string
+		Want    string
+	}{
+		{ProfileTrueColor, "\033[38;2;255;0;0m", "\033[38;2;255;0;0m"},
+		{ProfileTrueColor, "\033[38;5;196m", "\033[38;5;196m"},
+		{ProfileANSI256, "\033[38;2;255;0;0m", "\033[38;5;196m"},
+		{ProfileANSI256, "\033[1;48;2;0;0;255m", "\033[1;48;5;21m"},
+		{ProfileANSI256, "\033[38;5;196m", "\033[38;5;196m"},
+		{ProfileANSI256, "\033[91;2m", "\033[91;2m"},
+		{ProfileANSI16, "\033[38;5;196m", "\033[91m"},
+		{ProfileANSI16, "\033[1;38;5;196m", "\033[1;91m"},
+		{ProfileANSI16, "\033[38;2;255;0;0m", "\033[91m"},
+		{ProfileANSI16, "\033[38;2;180;20;20m", "\033[31m"},
+		{ProfileANSI16, "\033[48;2;0;0;230m", "\033[44m"},
+		{ProfileANSI16, "\033[38;2;128;128;128m", "\033[90m"},
+		{ProfileANSI16, "\033[38;5;250m", "\033[37m"},
+		{ProfileANSI16, "\033[91;2m", "\033[91;2m"},
+		{ProfileANSI16, "not an escape", "not an escape"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if got := test.Profile.convert(test.Esc); test.Want != got {
+				t.Fatalf("(-want +got)\n- %q\n+ %q", test.Want, got)
+			}
+		})
+	}
+}
+
+func TestColorProfileOption(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:     drop(slog.TimeKey, slog.LevelKey),
+		ColorKeysByKind: true,
+		KindKeyColors:   map[slog.Kind]string{slog.KindString: "\033[38;2;255;0;0m"},
+		ColorProfile:    ProfileANSI256,
+	}))
+	l.Info("test", "key", "val")
+
+	if want, got := "test \033[38;5;196mkey=\033[0mval\n", buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	buf.Reset()
+	l = slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:  drop(slog.TimeKey),
+		ColorProfile: ProfileNoColor,
+	}))
+	l.Info("test", "key", "val")
+
+	if want, got := "INF test key=val\n", buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestColorProfileANSI16(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:     drop(slog.TimeKey, slog.LevelKey),
+		ColorKeysByKind: true,
+		KindKeyColors: map[slog.Kind]string{
+			slog.KindString: "\033[38;2;250;250;90m",
+			slog.KindInt64:  "\033[38;2;20;20;220m",
+		},
+		ColorProfile: ProfileANSI16,
+	}))
+	l.Info("test", "key", "val", "num", 1)
+
+	if want, got := "test \033[93mkey=\033[0mval \033[34mnum=\033[0m1\n", buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestDetectColorProfile(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if got := DetectColorProfile(f); got != ProfileNoColor {
+		t.Fatalf("want ProfileNoColor for a regular file, got %d", got)
+	}
+}
+
+func TestAutoColor(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	for _, w := range []io.Writer{&buf, f} {
+		h := NewHandler(w, &Options{AutoColor: true}).(*Handler)
+		if !h.noColor || !h.noLevelColor {
+			t.Fatalf("want no color for %T", w)
+		}
+	}
+}
+
+func TestTrueColor(t *testing.T) {
+	theme := &Theme{
+		Info:       RGB{0, 255, 0},
+		Key:        RGB{1, 2, 3},
+		Value:      RGB{4, 5, 6},
+		ErrorKey:   RGB{255, 0, 0},
+		ErrorValue: RGB{200, 0, 0},
+	}
+
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		TrueColor:   true,
+		Theme:       theme,
+		Colors:      Colors{Value: ansiCyan},
+	}))
+	l.Info("test", "k", 1, "err", errTest)
+
+	want := "\033[38;2;0;255;0mINF\033[0m test " +
+		"\033[38;2;1;2;3mk=\033[0m\033[36m1\033[0m " +
+		"\033[38;2;255;0;0merr=\033[0m\033[38;2;200;0;0mfail\033[0m\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	buf.Reset()
+	l = slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:  drop(slog.TimeKey),
+		TrueColor:    true,
+		Theme:        theme,
+		ColorProfile: ProfileANSI256,
+	}))
+	l.Info("test")
+	if want, got := "\033[38;5;46mINF\033[0m test\n", buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	h := NewHandler(io.Discard, &Options{TrueColor: true}).(*Handler)
+	if want := DefaultTheme().Warn.escape(); h.colors.Warn != want {
+		t.Fatalf("want default theme warn color %q, got %q", want, h.colors.Warn)
+	}
+}
@@ -0,0 +1,113 @@
+package tinter
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// maxDiffFields bounds the number of fields of a value diffed with
+// Options.DiffKeys, larger values are always rendered in full
+const maxDiffFields = 256
+
+// diffField is a field of a value diffed with Options.DiffKeys
+type diffField struct {
+	name, value string
+}
+
+// diffFields returns the fields of a struct or map value, or of a pointer to
+// one, formatted with %+v in the order of the struct fields or sorted map keys.
+// It returns false for other values and values with too many fields.
+func diffFields(v any) ([]diffField, bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	var fields []diffField
+	switch rv.Kind() {
+	case reflect.Struct:
+		if rv.NumField() > maxDiffFields {
+			return nil, false
+		}
+		for i := 0; i < rv.NumField(); i++ {
+			fields = append(fields, diffField{rv.Type().Field(i).Name, fmt.Sprintf("%+v", rv.Field(i))})
+		}
+	case reflect.Map:
+		if rv.Len() > maxDiffFields {
+			return nil, false
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			fields = append(fields, diffField{fmt.Sprint(iter.Key()), fmt.Sprintf("%+v", iter.Value())})
+		}
+		sort.Slice(fields, func(i, j int) bool {
+			return fields[i].name < fields[j].name
+		})
+	default:
+		return nil, false
+	}
+	return fields, true
+}
+
+// appendDiff appends the fields of a struct or map value of the fully-qualified
+// key that changed since its previous value to the buffer, e.g.
+// "state{ +phase=running -retry }". Added and changed fields are prefixed by
+// "+", removed ones by "-". It returns false without appending anything for the
+// first value of the key and for values that are not diffed.
+func (h *Handler) appendDiff(buf *buffer, key, renderedKey string, v any) bool {
+	fields, ok := diffFields(v)
+	if !ok {
+		return false
+	}
+
+	h.state.mu.Lock()
+	prev, seen := h.state.diffs[key]
+	if h.state.diffs == nil {
+		h.state.diffs = make(map[string][]diffField)
+	}
+	h.state.diffs[key] = fields
+	h.state.mu.Unlock()
+	if !seen {
+		return false
+	}
+
+	prevValues := make(map[string]string, len(prev))
+	for _, f := range prev {
+		prevValues[f.name] = f.value
+	}
+
+	buf.WriteStringIf(!h.noColor, h.colors.Key)
+	h.appendString(buf, renderedKey, true)
+	buf.WriteString("{ ")
+	buf.WriteStringIf(!h.noColor, resetFor(h.colors.Key))
+	for _, f := range fields {
+		if value, ok := prevValues[f.name]; ok && value == f.value {
+			delete(prevValues, f.name)
+			continue
+		}
+		delete(prevValues, f.name)
+		buf.WriteStringIf(!h.noColor, h.colors.Info)
+		buf.WriteChar('+')
+		h.appendString(buf, f.name, true)
+		buf.WriteString(h.kvSep)
+		h.appendString(buf, f.value, true)
+		buf.WriteStringIf(!h.noColor, ansiReset)
+		buf.WriteChar(' ')
+	}
+	for _, f := range prev {
+		if _, ok := prevValues[f.name]; !ok {
+			continue
+		}
+		buf.WriteStringIf(!h.noColor, h.colors.Error)
+		buf.WriteChar('-')
+		h.appendString(buf, f.name, true)
+		buf.WriteStringIf(!h.noColor, ansiReset)
+		buf.WriteChar(' ')
+	}
+	buf.WriteStringIf(!h.noColor, h.colors.Key)
+	buf.WriteChar('}')
+	buf.WriteStringIf(!h.noColor, resetFor(h.colors.Key))
+	h.appendAttrEnd(buf)
+	return true
+}
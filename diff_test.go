@@ -0,0 +1,78 @@
+package tinter
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+func TestDiffKeys(t *testing.T) {
+	type job struct {
+		ID    int
+		Phase string
+	}
+
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:     true,
+		ReplaceAttr: drop(slog.TimeKey),
+		DiffKeys:    []string{"state", "g.job"},
+	}))
+
+	l.Info("test", "state", map[string]any{"phase": "starting", "retry": 1})
+	l.Info("test", "state", map[string]any{"phase": "running", "pid": 42})
+	l.Info("test", "state", map[string]any{"phase": "running", "pid": 42}, "n", 1)
+	l.Info("test", "state", "done")
+	l.WithGroup("g").Info("test", "job", job{1, "queued"})
+	l.WithGroup("g").Info("test", "job", &job{1, "done"})
+	l.Info("test", "job", job{1, "other"})
+
+	want := "INF test state=\"map[phase:starting retry:1]\"\n" +
+		"INF test state{ +phase=running +pid=42 -retry }\n" +
+		"INF test state{ } n=1\n" +
+		"INF test state=done\n" +
+		"INF test g.job=\"{ID:1 Phase:queued}\"\n" +
+		"INF test g.job{ +Phase=done }\n" +
+		"INF test job=\"{ID:1 Phase:other}\"\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestDiffKeysColor(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		DiffKeys:    []string{"s"},
+	}))
+	l.Info("test", "s", map[string]int{"a": 1, "b": 1})
+	buf.Reset()
+	l.Info("test", "s", map[string]int{"a": 2})
+
+	want := ansiBrightGreen + "INF" + ansiReset + " test " +
+		ansiFaint + "s{ " + ansiResetFaint +
+		ansiBrightGreen + "+a=2" + ansiReset + " " +
+		ansiBrightRed + "-b" + ansiReset + " " +
+		ansiFaint + "}" + ansiResetFaint + "\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestDiffKeysKeyValueSeparator(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:           true,
+		ReplaceAttr:       drop(slog.TimeKey),
+		DiffKeys:          []string{"s"},
+		KeyValueSeparator: ": ",
+	}))
+	l.Info("test", "s", map[string]string{"a": "1"})
+	l.Info("test", "s", map[string]string{"a": "x y"})
+
+	want := "INF test s: map[a:1]\n" +
+		"INF test s{ +a: \"x y\" }\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
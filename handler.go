@@ -24,16 +24,23 @@ See [slog.HandlerOptions] for details.
 		}),
 	)
 
+# Groups
+
+The keys of attributes in groups, whether added with [slog.Logger.WithGroup]
+or [slog.Group], are prefixed with the group names joined by dots, e.g.
+"http.request.method=GET", matching the flat attribute names of the
+OpenTelemetry semantic conventions. To render the group structure instead, see
+Options.GroupPrefixHeader and Options.CoalesceGroupPrefix.
+
 # Automatically Enable Colors
 
 Colors are enabled by default and can be disabled using the Options.NoColor
 attribute. To automatically enable colors based on the terminal capabilities,
-use e.g. the [go-isatty] package.
+set Options.AutoColor.
 
-	w := os.Stderr
 	logger := slog.New(
-		tinter.NewHandler(w, &tinter.Options{
-			NoColor: !isatty.IsTerminal(w.Fd()),
+		tinter.NewHandler(os.Stderr, &tinter.Options{
+			AutoColor: true,
 		}),
 	)
 
@@ -47,40 +54,98 @@ Color support on Windows can be added by using e.g. the [go-colorable] package.
 	)
 
 [zerolog.ConsoleWriter]: https://pkg.go.dev/github.com/rs/zerolog#ConsoleWriter
-[go-isatty]: https://pkg.go.dev/github.com/mattn/go-isatty
 [go-colorable]: https://pkg.go.dev/github.com/mattn/go-colorable
 */
 package tinter
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/rand"
 	"encoding"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log/slog"
+	"math"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unicode"
+	"unicode/utf8"
 )
 
 // ANSI modes
 const (
 	ansiReset              = "\033[0m"
+	ansiBold               = "\033[1m"
 	ansiFaint              = "\033[2m"
+	ansiReverse            = "\033[7m"
 	ansiResetFaint         = "\033[22m"
 	ansiBrightRed          = "\033[91m"
 	ansiBrightRedFaint     = "\033[91;2m"
 	ansiBrightGreen        = "\033[92m"
 	ansiBrightYellow       = "\033[93m"
 	ansiBrightMagentaFaint = "\033[95;2m"
+	ansiGreen              = "\033[32m"
+	ansiYellow             = "\033[33m"
+	ansiBlue               = "\033[34m"
+	ansiMagenta            = "\033[35m"
+	ansiCyan               = "\033[36m"
+	ansiBrightCyan         = "\033[96m"
+	ansiGreenFaint         = "\033[32;2m"
+	ansiYellowFaint        = "\033[33;2m"
+	ansiBlueFaint          = "\033[34;2m"
+	ansiCyanFaint          = "\033[36;2m"
 )
 
 var (
 	defaultLevel      = slog.LevelInfo
 	defaultTimeFormat = time.StampMilli
+
+	defaultDigitSeparator = ","
+	defaultBadgeWidth     = 3
+
+	defaultKeyValueSeparator = "="
+
+	defaultHexdumpThreshold = 16
+
+	lnavTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+	defaultIndent = "  "
+
+	defaultLevelChipPadding = 1
+
+	// defaultKindKeyColors is the key palette used by Options.ColorKeysByKind.
+	// Kinds without an entry use the regular faint key color.
+	defaultKindKeyColors = map[slog.Kind]string{
+		slog.KindString:   ansiGreenFaint,
+		slog.KindInt64:    ansiCyanFaint,
+		slog.KindUint64:   ansiCyanFaint,
+		slog.KindFloat64:  ansiCyanFaint,
+		slog.KindBool:     ansiYellowFaint,
+		slog.KindDuration: ansiBlueFaint,
+		slog.KindTime:     ansiBlueFaint,
+	}
+
+	// defaultKeyPalette is the key palette used by Options.RainbowKeys
+	defaultKeyPalette = []string{ansiCyan, ansiMagenta, ansiBlue, ansiYellow, ansiGreen, ansiBrightCyan}
 )
 
 // Options for a slog.Handler that writes tinted logs. A zero Options consists
@@ -94,6 +159,19 @@ type Options struct {
 	// Minimum level to log (Default: slog.LevelInfo)
 	Level slog.Leveler
 
+	// Minimum level to add the source code location for, if AddSource is
+	// enabled (Default: nil, all levels)
+	SourceMinLevel slog.Leveler
+
+	// Directory to render source files relative to, e.g. the module root.
+	// Files outside of it are rendered as "dir/file.go". (Default: "")
+	SourceBaseDir string
+
+	// Render the calling function after the source code location, without its
+	// package and with the receiver type of methods, e.g.
+	// "server.go:42 (*Server).handle" (Default: false)
+	SourceFunction bool
+
 	// ReplaceAttr is called to rewrite each non-group attribute before it is logged.
 	// See https://pkg.go.dev/log/slog#HandlerOptions for details.
 	ReplaceAttr func(groups []string, attr slog.Attr) slog.Attr
@@ -101,343 +179,3422 @@ type Options struct {
 	// Time format (Default: time.StampMilli)
 	TimeFormat string
 
+	// Named time format, overrides TimeFormat if set (Default: TimeFormatUnset)
+	TimeFormatName TimeFormatName
+
 	// Disable color (Default: false)
 	NoColor bool
-}
 
-// NewHandler creates a [slog.Handler] that writes tinted logs to Writer w,
-// using the default options. If opts is nil, the default options are used.
-func NewHandler(w io.Writer, opts *Options) slog.Handler {
-	h := &handler{
-		w:          w,
-		level:      defaultLevel,
-		timeFormat: defaultTimeFormat,
-	}
-	if opts == nil {
-		return h
-	}
+	// Prefix each record with its length as a little-endian uint32 instead of
+	// terminating it with a newline, so readers can split records that contain
+	// newlines (Default: false)
+	FramedOutput bool
 
-	h.addSource = opts.AddSource
-	if opts.Level != nil {
-		h.level = opts.Level
-	}
-	h.replaceAttr = opts.ReplaceAttr
-	if opts.TimeFormat != "" {
-		h.timeFormat = opts.TimeFormat
-	}
-	h.noColor = opts.NoColor
-	return h
-}
+	// Color attribute keys by the kind of their value, e.g. string keys green
+	// and numeric keys cyan. Error keys keep their own color (Default: false)
+	ColorKeysByKind bool
 
-// handler implements a [slog.Handler].
-type handler struct {
-	attrsPrefix string
-	groupPrefix string
-	groups      []string
+	// Key colors by value kind used by ColorKeysByKind, overriding the built-in
+	// palette per kind. Each value is an ANSI escape sequence.
+	KindKeyColors map[slog.Kind]string
 
-	mu sync.Mutex
-	w  io.Writer
+	// How levels are rendered (Default: LevelStyleText)
+	LevelStyle LevelStyle
 
-	addSource   bool
-	level       slog.Leveler
-	replaceAttr func([]string, slog.Attr) slog.Attr
-	timeFormat  string
-	noColor     bool
-}
+	// Render the record attributes with the given keys in fixed-width columns,
+	// in the declared order, right after the message. Missing attributes render
+	// as blanks to preserve the alignment; all other attributes trail after the
+	// columns (Default: nil)
+	Columns []Column
 
-// clone returns a shallow copy of the handler
-func (h *handler) clone() *handler {
-	return &handler{
-		attrsPrefix: h.attrsPrefix,
-		groupPrefix: h.groupPrefix,
-		groups:      h.groups,
-		w:           h.w,
-		addSource:   h.addSource,
-		level:       h.level,
-		replaceAttr: h.replaceAttr,
-		timeFormat:  h.timeFormat,
-		noColor:     h.noColor,
-	}
-}
+	// Append a faint short hash of the message as "msgid=ab12cd", so lines
+	// with the same message can be grouped even if their attributes differ
+	// (Default: false)
+	ShowMessageHash bool
 
-// Enabled returns true if the level is enabled
-func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
-	return level >= h.level.Level()
-}
+	// Write the time at the end of the line instead of the start, keeping
+	// messages left-aligned (Default: false)
+	TimeAtEnd bool
 
-// Handle writes a log record to the handler's writer
-func (h *handler) Handle(_ context.Context, r slog.Record) error {
-	// get a buffer from the sync pool
-	buf := newBuffer()
-	defer buf.Free()
+	// Maximum depth of nested groups. Groups nested deeper are summarized by
+	// the number of fields they contain, e.g. "deep.group{…5 fields}". Groups
+	// of the handler added with WithGroup count towards the depth, so with a
+	// maximum depth of 1, every group of a record logged by
+	// WithGroup("http") is summarized. (Default: 0, unlimited)
+	MaxGroupDepth int
 
-	rep := h.replaceAttr
+	// Render the time followed by a faint delta to the time of the previous
+	// record in parentheses, e.g. "15:04:05.123 (+12ms)" (Default: false)
+	ShowAbsoluteAndRelativeTime bool
 
-	// write time
-	if !r.Time.IsZero() {
-		val := r.Time.Round(0) // strip monotonic to match Attr behavior
-		if rep == nil {
-			h.appendTime(buf, r.Time)
-			buf.WriteChar(' ')
-		} else if a := rep(nil /* groups */, slog.Time(slog.TimeKey, val)); a.Key != "" {
-			if a.Value.Kind() == slog.KindTime {
-				h.appendTime(buf, a.Value.Time())
-			} else {
-				h.appendValue(buf, a.Value, false)
-			}
-			buf.WriteChar(' ')
-		}
-	}
+	// Color profile of the terminal. Colors exceeding the capabilities of the
+	// profile are downgraded, see [DetectColorProfile] (Default:
+	// ProfileTrueColor)
+	ColorProfile ColorProfile
 
-	// write level
-	if rep == nil {
-		h.appendLevel(buf, r.Level)
-		buf.WriteChar(' ')
-	} else if a := rep(nil /* groups */, slog.Any(slog.LevelKey, r.Level)); a.Key != "" {
-		h.appendValue(buf, a.Value, false)
-		buf.WriteChar(' ')
-	}
+	// Detect the color profile of the writer once, with [DetectColorProfile]
+	// if it is an *os.File, and disable colors for other writers. The detected
+	// profile is used if it is more limited than ColorProfile.
+	// (Default: false)
+	AutoColor bool
 
-	// write source
-	if h.addSource {
-		fs := runtime.CallersFrames([]uintptr{r.PC})
-		f, _ := fs.Next()
-		if f.File != "" {
-			src := &slog.Source{
-				Function: f.Function,
-				File:     f.File,
-				Line:     f.Line,
-			}
+	// Use the 24-bit colors of Theme for the time, levels, keys, values and
+	// errors, unless set in Colors. They are downgraded to ColorProfile like
+	// other colors. (Default: false)
+	TrueColor bool
 
-			if rep == nil {
-				h.appendSource(buf, src)
-				buf.WriteChar(' ')
-			} else if a := rep(nil /* groups */, slog.Any(slog.SourceKey, src)); a.Key != "" {
-				h.appendValue(buf, a.Value, false)
-				buf.WriteChar(' ')
-			}
-		}
-	}
+	// Colors used if TrueColor is set (Default: DefaultTheme())
+	Theme *Theme
 
-	// write message
-	if rep == nil {
-		buf.WriteString(r.Message)
-		buf.WriteChar(' ')
-	} else if a := rep(nil /* groups */, slog.String(slog.MessageKey, r.Message)); a.Key != "" {
-		h.appendValue(buf, a.Value, false)
-		buf.WriteChar(' ')
-	}
+	// Pad the time to a fixed visible width, the widest time of its format
+	// unless PadTimeWidth is set, to align formats of variable width like
+	// time.Kitchen (Default: false)
+	PadTime bool
 
-	// write handler attributes
-	if len(h.attrsPrefix) > 0 {
-		buf.WriteString(h.attrsPrefix)
-	}
+	// Visible width of the time if PadTime is set (Default: 0, the widest
+	// time of the format)
+	PadTimeWidth int
 
-	// write attributes
-	r.Attrs(func(attr slog.Attr) bool {
-		h.appendAttr(buf, attr, h.groupPrefix, h.groups)
-		return true
-	})
+	// Separate groups of three digits of integer values, e.g. "1,234,567"
+	// (Default: false)
+	GroupDigits bool
 
-	if len(*buf) == 0 {
-		return nil
-	}
-	(*buf)[len(*buf)-1] = '\n' // replace last space with newline
+	// Separator used by GroupDigits (Default: ",")
+	DigitSeparator string
 
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	// Names of integer values by fully-qualified key, e.g. {"state": {0:
+	// "idle", 1: "running"}}. Named values are rendered as "running(1)", values
+	// without a name as the plain number (Default: nil)
+	IntEnums map[string]map[int64]string
 
-	_, err := h.w.Write(*buf)
-	return err
-}
+	// Render only the name of values in IntEnums, e.g. "running" instead of
+	// "running(1)" (Default: false)
+	IntEnumNameOnly bool
 
-// WithAttrs returns a new handler with the given attributes
-func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	if len(attrs) == 0 {
-		return h
-	}
-	h2 := h.clone()
+	// Render the groups of a handler created with WithGroup once as a header
+	// after the level, e.g. "[http]", instead of prefixing each key with them.
+	// Groups added after attributes with WithAttrs prefix the keys as usual,
+	// as the header would include the earlier attributes. Groups of
+	// attributes are not affected (Default: false)
+	GroupPrefixHeader bool
 
-	buf := newBuffer()
-	defer buf.Free()
+	// Title of a faint banner line written once by NewHandler, marking the
+	// start of a session with the title, process ID and time, e.g.
+	// "--- myapp pid=1234 Nov 10 23:00:00.000 ---" (Default: "", no banner)
+	StartupBanner string
 
-	// write attributes to buffer
-	for _, attr := range attrs {
-		h.appendAttr(buf, attr, h.groupPrefix, h.groups)
-	}
-	h2.attrsPrefix = h.attrsPrefix + string(*buf)
-	return h2
-}
+	// Colors of the builtin fields. Empty fields use the default colors
+	// (Default: zero Colors)
+	Colors Colors
 
-// WithGroup returns a new handler with the given group name
-func (h *handler) WithGroup(name string) slog.Handler {
-	if name == "" {
-		return h
-	}
-	h2 := h.clone()
-	h2.groupPrefix += name + "."
-	h2.groups = append(h2.groups, name)
-	return h2
-}
+	// Colors of levels by the lowest level of their band, i.e.
+	// slog.LevelDebug-4, slog.LevelDebug, slog.LevelInfo, slog.LevelWarn and
+	// slog.LevelError. They are written as is, take precedence over the level
+	// colors of Colors, which are still used for other elements, and are
+	// ignored if NoColor is set. (Default: nil)
+	LevelColors map[slog.Level]string
 
-// appendTime appends a time to the buffer
-func (h *handler) appendTime(buf *buffer, t time.Time) {
-	buf.WriteStringIf(!h.noColor, ansiFaint)
-	*buf = t.AppendFormat(*buf, h.timeFormat)
-	buf.WriteStringIf(!h.noColor, ansiReset)
-}
+	// Minimum visible width of attribute values, padded with spaces. Errors are
+	// not padded (Default: 0)
+	ValueColumn int
 
-// appendLevel appends a level to the buffer
-func (h *handler) appendLevel(buf *buffer, level slog.Level) {
-	switch {
-	case level <= slog.LevelDebug-4:
-		buf.WriteStringIf(!h.noColor, ansiFaint)
-		buf.WriteString("TRC")
-		appendLevelDelta(buf, level-slog.LevelDebug+4)
-		buf.WriteStringIf(!h.noColor, ansiReset)
-	case level < slog.LevelInfo:
-		buf.WriteStringIf(!h.noColor, ansiBrightMagentaFaint)
-		buf.WriteString("DBG")
-		appendLevelDelta(buf, level-slog.LevelDebug)
-		buf.WriteStringIf(!h.noColor, ansiReset)
-	case level < slog.LevelWarn:
-		buf.WriteStringIf(!h.noColor, ansiBrightGreen)
-		buf.WriteString("INF")
-		appendLevelDelta(buf, level-slog.LevelInfo)
-		buf.WriteStringIf(!h.noColor, ansiReset)
-	case level < slog.LevelError:
-		buf.WriteStringIf(!h.noColor, ansiBrightYellow)
-		buf.WriteString("WRN")
-		appendLevelDelta(buf, level-slog.LevelWarn)
-		buf.WriteStringIf(!h.noColor, ansiReset)
-	default:
-		buf.WriteStringIf(!h.noColor, ansiBrightRed)
-		buf.WriteString("ERR")
-		appendLevelDelta(buf, level-slog.LevelError)
-		buf.WriteStringIf(!h.noColor, ansiReset)
-	}
-}
+	// Minimum visible width of the values of attributes by fully-qualified
+	// key, padded with spaces, e.g. {"status": 4} to align "OK" and "FAIL".
+	// Overrides ValueColumn if wider. (Default: nil)
+	ValuePad map[string]int
 
-// appendLevelDelta appends a level delta to the buffer
-func appendLevelDelta(buf *buffer, delta slog.Level) {
-	if delta == 0 {
-		return
-	} else if delta > 0 {
-		buf.WriteChar('+')
-	}
-	*buf = strconv.AppendInt(*buf, int64(delta), 10)
-}
+	// Minimum visible width of attribute keys including their groups, padded
+	// with spaces before the key-value separator to align values. Longer keys
+	// and the keys of errors are not padded. (Default: 0)
+	KeyWidth int
 
-// appendSource appends source details to the buffer
-func (h *handler) appendSource(buf *buffer, src *slog.Source) {
-	dir, file := filepath.Split(src.File)
+	// Use a fixed layout that can be parsed by a custom lnav log format
+	// (Default: false). Each line consists of the time in ISO 8601 format with
+	// milliseconds, the level as full uppercase name padded to five characters,
+	// the source if AddSource is set, the message and the attributes in logfmt,
+	// separated by spaces and without colors:
+	//
+	//	2009-11-10T23:00:00.000Z INFO  message key=val
+	//
+	// Lines can be matched by the following lnav regex:
+	//
+	//	^(?<timestamp>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}(?:Z|[+-]\d{2}:\d{2})) (?<level>[A-Z]+(?:[+-]\d+)?)\s+(?<body>.*)$
+	//
+	// LnavCompatible overrides TimeFormat, TimeFormatByLevel, NoColor,
+	// LevelStyle, LevelLabels, LevelPipeFormat, TimeAtEnd,
+	// ShowAbsoluteAndRelativeTime, Columns, GroupPrefixHeader, NoQuote,
+	// MultilineAttrs, HexdumpBytes, ErrorStackTrace, SystemdPrefix,
+	// RelativeTime, LevelChip, CardMode, NoTime, HideAttrs, ShowUptime,
+	// CoalesceGroupPrefix, HTMLOutput, PrettyStructs, AddMonotonic,
+	// IndentDepth, LevelShortCodes, KeyWidth and AnnotateKeyTypes, and makes
+	// [Handler.WithIndent] a no-op.
+	LnavCompatible bool
 
-	buf.WriteStringIf(!h.noColor, ansiFaint)
-	buf.WriteString(filepath.Join(filepath.Base(dir), file))
-	buf.WriteChar(':')
-	buf.WriteString(strconv.Itoa(src.Line))
-	buf.WriteStringIf(!h.noColor, ansiReset)
+	// Render the errors of an error created with errors.Join separately, with
+	// their index added to the key, e.g. "err[0]=... err[1]=..." (Default:
+	// false)
+	ExpandJoinedErrors bool
+
+	// Render each layer of a wrapped error chain separately, walking
+	// errors.Unwrap. The outermost layer keeps the attribute key, each cause
+	// is added with the key "cause" and the same group prefix, e.g.
+	// "err=outer cause=middle cause=inner". The message of a layer is its
+	// Error() with the ": "-separated message of its cause trimmed
+	// (Default: false)
+	ExpandErrors bool
+
+	// Color each attribute key by a hash of the fully-qualified key, so the
+	// same key always has the same color. Takes precedence over
+	// ColorKeysByKind (Default: false)
+	RainbowKeys bool
+
+	// Key colors used by RainbowKeys. Each value is an ANSI escape sequence
+	// (Default: cyan, magenta, blue, yellow, green and bright cyan)
+	KeyPalette []string
+
+	// Position of error attributes relative to the other attributes (Default:
+	// ErrorsInline)
+	ErrorPosition ErrorPosition
+
+	// Suppress records repeating the error message of a record logged within
+	// the duration. The first record after the duration has passed includes
+	// the number of occurrences as "count=N". Zero disables coalescing.
+	// (Default: 0)
+	CoalesceErrors time.Duration
+
+	// Append the number of rendered and seen attributes to each record, e.g.
+	// "(rendered 3/5)", to debug attributes dropped by ReplaceAttr. Intended
+	// for development only. (Default: false)
+	DebugAttrs bool
+
+	// Render the time, level and message on a header line and each attribute
+	// on its own line below, indented by Indent. Columns are ignored in card
+	// mode. (Default: false)
+	CardMode bool
+
+	// Indentation of the attribute lines in card mode, and of records per
+	// depth, see IndentDepth (Default: "  ")
+	Indent string
+
+	// Depth of the indentation of records, rendered as IndentDepth times
+	// Indent before each record. Handlers derived with [Handler.WithIndent]
+	// are indented one level deeper, to nest the records of nested calls.
+	// Ignored with LnavCompatible. (Default: 0)
+	IndentDepth int
+
+	// Render records with more than MultilineThreshold attributes, including
+	// handler attributes, like in card mode, with each attribute on its own
+	// line indented by Indent (Default: false)
+	MultilineAttrs bool
+
+	// Number of attributes above which records are rendered across lines if
+	// MultilineAttrs is set (Default: 0, records with any attributes)
+	MultilineThreshold int
+
+	// Render the quotes of quoted values in faint, so values containing
+	// spaces stand out (Default: false)
+	HighlightQuoted bool
+
+	// Fully-qualified keys of numeric attributes to append the per-second rate
+	// of change since the previously logged value of the key to, e.g.
+	// "requests=1000 (+50/s)". The first value of a key has no rate. Only the
+	// last value of each key is kept. (Default: nil)
+	ShowRate []string
+
+	// Omit the time (Default: false)
+	NoTime bool
+
+	// Omit all attributes, rendering only the time, level and message
+	// (Default: false)
+	HideAttrs bool
+
+	// Elements to color, e.g. only the level and errors (Default:
+	// ColorScopeAll)
+	ColorScope ColorScope
+
+	// Append a machine-readable trailer to each line, separated by the ASCII
+	// record separator "\x1e". The trailer holds the record in the logfmt
+	// format of [slog.TextHandler], without colors. Values containing the
+	// separator are quoted and separators elsewhere, e.g. in the message, are
+	// escaped as "\x1e", so the line can be split at its first separator.
+	// (Default: false)
+	StructuredTrailer bool
+
+	// Text to render zero time.Time attribute values as, e.g. "-". Does not
+	// apply to the time of the record. (Default: "", rendered as the zero
+	// time)
+	ZeroTimeText string
+
+	// Show the time since the handler was created as a faint token after the
+	// time, e.g. "uptime=3h12m0s". Combine with NoTime to replace the time.
+	// (Default: false)
+	ShowUptime bool
+
+	// Add the nanoseconds since the handler was created, from the monotonic
+	// clock, as a faint token after the time, e.g. "mono=1234567", for
+	// ordering and latency math immune to clock adjustments (Default: false)
+	AddMonotonic bool
+
+	// Render the time of records as the faint time elapsed since the handler
+	// was created instead of the wall-clock time, e.g. "+1.234s". Unlike
+	// ShowUptime, the elapsed time is computed from the time of the record.
+	// Handlers derived with WithAttrs and WithGroup share the start time.
+	// (Default: false)
+	RelativeTime bool
+
+	// Render runs of two or more consecutive attributes with the same group
+	// prefix with the prefix once, e.g. "http.{method=GET status=200}" instead
+	// of "http.method=GET http.status=200". Errors, attributes without a group
+	// and attributes with another prefix end a run. Handler and record
+	// attributes form separate runs. Ignored in card mode and with Columns.
+	// (Default: false)
+	CoalesceGroupPrefix bool
+
+	// Write each distinct message only once, suppressing later records with
+	// the same message regardless of their attributes. Up to 4096 messages are
+	// remembered, forgetting the oldest first. (Default: false)
+	OncePerMessage bool
+
+	// Syntax highlighting formats of attribute values by fully-qualified key,
+	// either "json" or "url", e.g. {"body": "json"}. Highlighted values are not
+	// quoted. Ignored if colors are disabled. (Default: nil)
+	SyntaxHighlight map[string]string
+
+	// Write a faint summary line with the number of records per level after
+	// every N records, e.g. "…150 records: 140 INF, 7 WRN, 3 ERR so far".
+	// Records of derived handlers are counted together. Zero disables the
+	// summary. (Default: 0)
+	SummaryEvery int
+
+	// Write HTML instead of ANSI escapes, for web-based log viewers. Text is
+	// HTML-escaped and colored elements are wrapped in <span> elements with
+	// the CSS classes "tinter-time", "tinter-debug", "tinter-info",
+	// "tinter-warn", "tinter-error", "tinter-msg", "tinter-key",
+	// "tinter-value", "tinter-source", "tinter-error-key",
+	// "tinter-error-value" and "tinter-faint", which is also used for trace
+	// levels. Colors, ColorKeysByKind, RainbowKeys, HighlightQuoted and
+	// SyntaxHighlight are ignored. If NoColor is set, no spans are written.
+	// Ignored with LnavCompatible. (Default: false)
+	HTMLOutput bool
+
+	// Short codes of levels, rendered instead of the default label for an
+	// exact match of the level, e.g. {slog.LevelInfo + 2: "NTC"}. The code is
+	// colored like the band of the level. (Default: nil)
+	LevelShortCodes map[slog.Level]string
+
+	// Add a random ID generated by NewHandler to each record as a faint token
+	// after the level, e.g. "inst=3f9a2c", to distinguish the records of
+	// multiple handlers. Derived handlers share the ID of their parent, unless
+	// InstanceIDPerDerived is set. (Default: false)
+	AddInstanceID bool
+
+	// Generate a new instance ID for each handler derived with WithAttrs or
+	// WithGroup, if AddInstanceID is set (Default: false)
+	InstanceIDPerDerived bool
+
+	// Render struct, map, slice and array values across lines, with their
+	// fields and elements indented by Indent. Cyclic pointers are rendered as
+	// "<cycle>". Byte slices and arrays and values implementing fmt.Stringer
+	// or error are rendered as usual. Ignored with LnavCompatible. (Default:
+	// false)
+	PrettyStructs bool
+
+	// Maximum nesting depth of pretty-printed values, deeper values are
+	// rendered as "…" (Default: 0, unlimited)
+	PrettyStructsMaxDepth int
+
+	// Time formats by level, overriding TimeFormat for records of an exact
+	// level or, failing that, of the lowest level of its band, e.g.
+	// {slog.LevelError: time.RFC3339} for all error records (Default: nil)
+	TimeFormatByLevel map[slog.Level]string
+
+	// Names of groups omitted from the prefix of rendered keys, e.g. with
+	// {"otel"} the key "otel.span.id" is rendered as "span.id". ReplaceAttr
+	// still receives all groups. (Default: nil)
+	HidePrefixGroups []string
+
+	// Labels of levels, rendered instead of the default labels of
+	// LevelStyleText and LevelStyleFull, e.g. {slog.LevelError: "error"} or
+	// localized {slog.LevelError: "错误"}. The label of the lowest level of a
+	// band followed by the delta is used for levels without a label, e.g.
+	// "error+2". Labels are padded by their number of runes. (Default: nil)
+	LevelLabels map[slog.Level]string
+
+	// Fully-qualified keys of boolean attributes rendered as badges, "[ ON]"
+	// in the info color or "[OFF]" in the error color, e.g. for status
+	// dashboards (Default: nil)
+	BadgeKeys []string
+
+	// Visible width of the text of badges, right-aligned within the brackets
+	// (Default: 3)
+	BadgeWidth int
+
+	// Fully-qualified keys of struct and map attributes rendered as the fields
+	// that changed since the previous value of the key, e.g.
+	// "state{ +phase=running -retry }". The first value of a key and values
+	// with more than 256 fields are rendered in full. Only the last value of
+	// each key is kept. (Default: nil)
+	DiffKeys []string
+
+	// Replace "{key}" references in messages by the values of the record
+	// attributes with the key relative to the groups of the handler, e.g.
+	// "user {user.id} logged in". References without a matching attribute
+	// are left as is. (Default: false)
+	InterpolateMessage bool
+
+	// Omit attributes referenced in the message from the attributes, if
+	// InterpolateMessage is set (Default: false)
+	InterpolateRemoveAttrs bool
+
+	// FlagAttr is called for each non-group, non-error attribute, after
+	// ReplaceAttr, and returns a background color, e.g. "\033[41m", for the
+	// whole key=value pair of attributes that must not be missed. It is not
+	// called if NoColor is set. (Default: nil)
+	FlagAttr func(groups []string, attr slog.Attr) (bgColor string, ok bool)
+
+	// Faint divider between the message and handler attributes and the
+	// record attributes, e.g. "│", written only if record attributes are
+	// rendered and not with Columns (Default: "")
+	AttrDivider string
+
+	// Write attribute values verbatim instead of quoting those with spaces,
+	// quotes, '=' or unprintable characters. Keys are still quoted.
+	// (Default: false)
+	NoQuote bool
+
+	// ReplaceLevel is called to rewrite each level before it is rendered and
+	// colored, including slog.Level attribute values, e.g. to clamp custom
+	// levels into the standard bands. It runs after ReplaceAttr and does not
+	// affect which records are enabled. (Default: nil)
+	ReplaceLevel func(level slog.Level) slog.Level
+
+	// Render levels as full names padded to a width of five, followed by a
+	// pipe in the color of the level, e.g. "ERROR | " or "INFO  | ", for
+	// unambiguous grepping. Overrides LevelStyle. (Default: false)
+	LevelPipeFormat bool
+
+	// Render record attributes in reverse order, the last one first.
+	// Attributes within groups and handler attributes keep their order, the
+	// latter preceding the record attributes. (Default: false)
+	ReverseAttrs bool
+
+	// Sort attributes by key, stably and before ReplaceAttr, for diffable
+	// output. Record attributes, attributes within groups and the attributes
+	// of each WithAttrs call are sorted separately, handler attributes
+	// preceding the record attributes. Overrides ReverseAttrs.
+	// (Default: false)
+	SortKeys bool
+
+	// Render []byte values longer than HexdumpThreshold as a canonical
+	// hexdump with offsets, hex bytes and ASCII, on lines below the key
+	// indented by Indent. The following attributes continue on a new line.
+	// (Default: false)
+	HexdumpBytes bool
+
+	// Length of []byte values above which they are rendered as a hexdump if
+	// HexdumpBytes is set (Default: 16)
+	HexdumpThreshold int
+
+	// Separator between keys and values, e.g. ": ". Values containing it are
+	// quoted. (Default: "=")
+	KeyValueSeparator string
+
+	// Render the stack trace carried by error attributes on lines below the
+	// error, indented by Indent and faint. An error carries a stack trace if
+	// it or an error it wraps has a StackTrace method returning a slice of
+	// program counters, e.g. []uintptr or the StackTrace of
+	// github.com/pkg/errors. Frames are rendered like sources, see
+	// SourceBaseDir (Default: false)
+	ErrorStackTrace bool
+
+	// Render values without a specific representation, e.g. maps and
+	// structs, as JSON instead of with fmt's "%+v", falling back to it if
+	// json.Marshal fails. The JSON is quoted only if it contains spaces or
+	// KeyValueSeparator. PrettyStructs takes precedence. Values implementing
+	// both json.Marshaler and fmt.Stringer are rendered as JSON too.
+	// (Default: false)
+	MarshalJSON bool
+
+	// Render values without a specific representation with fmt's Go-syntax
+	// "%#v" instead of "%+v", showing their types, e.g.
+	// "main.user{Name:\"a\"}" instead of "{Name:a}". PrettyStructs takes
+	// precedence, MarshalJSON is ignored. (Default: false)
+	GoSyntaxValues bool
+
+	// Fully-qualified keys of attributes whose slog.KindAny values are all
+	// rendered with "%#v", regardless of their type (Default: nil)
+	GoSyntaxKeys []string
+
+	// Prefix each record with the syslog priority of its level understood by
+	// the systemd journal, e.g. "<6>" for info, so that journald categorizes
+	// and colors it. Debug and trace map to 7, info to 6, warn to 4 and error
+	// to 3. Usually combined with NoColor (Default: false)
+	SystemdPrefix bool
+
+	// Omit the level token if SystemdPrefix is set, as the priority already
+	// carries the level (Default: false)
+	SystemdPrefixOnly bool
+
+	// Hold back the last DumpContextOnError records below the error level
+	// instead of writing them, and write them before the next error record,
+	// so that only the context leading up to errors is logged. Older records
+	// are dropped. Records still held back when the program exits are
+	// discarded (Default: 0, records are written immediately)
+	DumpContextOnError int
+
+	// Location to convert the time of records and time values to before
+	// rendering them, e.g. time.UTC (Default: nil, the location of the time)
+	TimeLocation *time.Location
+
+	// Render times in UTC, a shorthand for TimeLocation set to time.UTC,
+	// which takes precedence (Default: false)
+	UTC bool
+
+	// Annotate each attribute key with the kind of its value in faint angle
+	// brackets, e.g. "count<int64>=1" or "dur<duration>=1s", or with the Go
+	// type of slog.KindAny values, e.g. "ids<[]int>=[1 2]" (Default: false)
+	AnnotateKeyTypes bool
+
+	// Buffer the output in a bufio.Writer, which is written to the writer
+	// when full or when the handler is flushed with [Handler.Flush], which is
+	// safe for concurrent use with logging. Once writing to the writer
+	// failed, Handle and Flush return the error of the failed write, and
+	// nothing is written anymore. Flush before the program exits, see also
+	// [FlushOnPanic]. (Default: false)
+	BufferWrites bool
+
+	// Render the attributes after the first DimTailAttrs faint, drawing the
+	// eye to the first, usually most important, attributes. Attributes in
+	// groups count individually, handler attributes precede the record
+	// attributes. Errors and flagged attributes keep their colors.
+	// (Default: 0, all attributes are rendered normally)
+	DimTailAttrs int
+
+	// Render levels as chips: full uppercase names, padded to a width of five,
+	// on a block of the level color, e.g. " ERROR ". Without colors, the
+	// padded name is rendered without the chip. Overrides LevelStyle, but not
+	// LevelShortCodes. (Default: false)
+	LevelChip bool
+
+	// Spaces on each side of the name within a level chip. Values below 1 use
+	// the default. (Default: 1)
+	LevelChipPadding int
+
+	// Minimum visible width of integer and float values of attributes by
+	// fully-qualified key, right-aligned by left-padding them with spaces,
+	// e.g. {"bytes": 6} for "bytes=  1024", to compare numbers across lines.
+	// Digit separators count towards the width. (Default: nil)
+	RightAlignNumbers map[string]int
+
+	// Encoding of []byte values, unless rendered as a hexdump, see
+	// HexdumpBytes (Default: BytesFormatDefault)
+	BytesFormat BytesFormat
+
+	// Render the attributes of groups added with slog.Group inline in braces
+	// under the key of the group, e.g. "req={method=GET header={id=1}}",
+	// instead of prefixing their keys with the group. Empty groups are
+	// omitted. Groups of a handler created with WithGroup still prefix the
+	// keys. Ignored in card mode and with Columns. (Default: false)
+	InlineGroups bool
+
+	// Render the attributes without colors, including errors, while the time,
+	// level and message stay colored, so that parsers of the attributes never
+	// see escape sequences (Default: false)
+	PlainAttrTail bool
+
+	// Render groups added with slog.Group as compact JSON objects under the
+	// key of the group, e.g. `req={"method":"GET","header":{"id":1}}`,
+	// instead of prefixing their keys with the group. Strings, numbers and
+	// booleans are JSON values, other values are rendered as usual into JSON
+	// strings. The JSON is quoted only if it contains spaces or
+	// KeyValueSeparator. Empty groups are omitted. Takes precedence over
+	// InlineGroups, ignored with Columns. (Default: false)
+	GroupsAsJSON bool
+
+	// ANSI escape sequence used to color the message, e.g. "\033[1;36m". A
+	// shorthand for Colors.Message, which takes precedence if set. Applies to
+	// messages rewritten by ReplaceAttr too. (Default: "")
+	MessageColor string
+
+	// Maximum number of record lines written per second, protecting slow
+	// terminals from log storms. Bursts of up to MaxLinesPerSecond lines are
+	// written at once, then lines exceeding the rate are dropped, never
+	// blocking the caller. The number of dropped lines is reported by a faint
+	// "dropped N lines" notice before the next written line. Lines held back
+	// by DumpContextOnError are counted when they are logged. Zero disables
+	// the throttle. (Default: 0)
+	MaxLinesPerSecond int
+
+	// Mark records logged by goroutines other than the main one with a faint
+	// "[bg]" before the message, to spot background logs while debugging
+	// concurrency. The main goroutine is the one that initialized the
+	// package, which is a heuristic: it's wrong if the package is first
+	// imported by a plugin, and tests never run in it. (Default: false)
+	MarkNonMainGoroutine bool
 }
 
-// appendAttr appends an attribute to the buffer
-func (h *handler) appendAttr(buf *buffer, attr slog.Attr, groupsPrefix string, groups []string) {
-	attr.Value = attr.Value.Resolve()
-	if rep := h.replaceAttr; rep != nil && attr.Value.Kind() != slog.KindGroup {
-		attr = rep(groups, attr)
-		attr.Value = attr.Value.Resolve()
-	}
+// ColorScope controls which elements of a record are colored, see
+// Options.ColorScope.
+type ColorScope int
 
-	if attr.Equal(slog.Attr{}) {
-		return
-	}
+const (
+	// ColorScopeAll colors all elements.
+	ColorScopeAll ColorScope = iota
 
-	if attr.Value.Kind() == slog.KindGroup {
-		if attr.Key != "" {
-			groupsPrefix += attr.Key + "."
-			groups = append(groups, attr.Key)
-		}
-		for _, groupAttr := range attr.Value.Group() {
-			h.appendAttr(buf, groupAttr, groupsPrefix, groups)
-		}
-	} else if err, ok := attr.Value.Any().(error); ok {
-		h.appendError(buf, err, attr.Key, groupsPrefix)
-		buf.WriteChar(' ')
-	} else {
-		h.appendKey(buf, attr.Key, groupsPrefix)
-		h.appendValue(buf, attr.Value, true)
-		buf.WriteChar(' ')
+	// ColorScopeLevelAndErrors colors only the level and error attributes.
+	ColorScopeLevelAndErrors
+
+	// ColorScopeLevelOnly colors only the level.
+	ColorScopeLevelOnly
+
+	// ColorScopeNone colors nothing, equivalent to Options.NoColor.
+	ColorScopeNone
+)
+
+// MinimalTheme returns options for the most compact interactive output: a
+// colored one-character level followed by the message in bold, e.g. "I
+// connected". It sets:
+//
+//   - NoTime, to omit the time
+//   - LevelStyle to LevelStyleChar
+//   - HideAttrs, to omit all attributes
+//   - Colors.Message to bold
+//
+// The returned options can be modified further before passing them to
+// NewHandler.
+func MinimalTheme() *Options {
+	return &Options{
+		NoTime:     true,
+		LevelStyle: LevelStyleChar,
+		HideAttrs:  true,
+		Colors: Colors{
+			Message: ansiBold,
+		},
 	}
 }
 
-// appendKey appends a key to the buffer
-func (h *handler) appendKey(buf *buffer, key, groups string) {
-	buf.WriteStringIf(!h.noColor, ansiFaint)
-	appendString(buf, groups+key, true)
-	buf.WriteChar('=')
-	buf.WriteStringIf(!h.noColor, ansiReset)
-}
+// BytesFormat controls how []byte values are rendered, see
+// Options.BytesFormat.
+type BytesFormat int
 
-// appendValue appends a value to the buffer
-func (h *handler) appendValue(buf *buffer, v slog.Value, quote bool) {
-	switch v.Kind() {
-	case slog.KindString:
-		appendString(buf, v.String(), quote)
-	case slog.KindInt64:
-		*buf = strconv.AppendInt(*buf, v.Int64(), 10)
-	case slog.KindUint64:
-		*buf = strconv.AppendUint(*buf, v.Uint64(), 10)
-	case slog.KindFloat64:
-		*buf = strconv.AppendFloat(*buf, v.Float64(), 'g', -1, 64)
-	case slog.KindBool:
-		*buf = strconv.AppendBool(*buf, v.Bool())
-	case slog.KindDuration:
-		appendString(buf, v.Duration().String(), quote)
-	case slog.KindTime:
-		appendString(buf, v.Time().String(), quote)
+const (
+	// BytesFormatDefault renders bytes with fmt's "%+v", e.g. "[104 105]".
+	BytesFormatDefault BytesFormat = iota
+
+	// BytesFormatHex renders bytes as lowercase hex, e.g. "6869".
+	BytesFormatHex
+
+	// BytesFormatBase64 renders bytes as standard base64 with padding, e.g.
+	// "aGk=".
+	BytesFormatBase64
+
+	// BytesFormatQuoted renders bytes as an always quoted Go string, e.g.
+	// "\"hi\"".
+	BytesFormatQuoted
+
+	// BytesFormatRaw renders bytes as a string, quoted only if needed like
+	// string values, e.g. "hi".
+	BytesFormatRaw
+)
+
+// ErrorPosition controls where error attributes are rendered, see
+// Options.ErrorPosition.
+type ErrorPosition int
+
+const (
+	// ErrorsInline renders errors in the order they were added.
+	ErrorsInline ErrorPosition = iota
+
+	// ErrorsFirst renders errors before all other attributes, in the order
+	// they were added.
+	ErrorsFirst
+
+	// ErrorsLast renders errors after all other attributes, in the order they
+	// were added.
+	ErrorsLast
+)
+
+// Colors holds the ANSI escape sequences used to color the builtin fields of a
+// record. An empty field uses the default color of that field.
+type Colors struct {
+	Time  string // Default: faint
+	Debug string // Default: faint bright magenta
+	Info  string // Default: bright green
+	Warn  string // Default: bright yellow
+	Error string // Default: bright red
+
+	Message string // Default: none
+	Key     string // Default: faint
+	Value   string // Default: none
+	Source  string // Default: faint
+
+	ErrorKey   string // Key of error attributes (Default: faint bright red)
+	ErrorValue string // Value of error attributes (Default: bright red)
+
+	// Faint is used for trace levels and other secondary details, e.g. the
+	// message hash (Default: faint)
+	Faint string
+}
+
+// Column declares a fixed-width attribute column, see Options.Columns.
+type Column struct {
+	// Fully-qualified key of the attribute, e.g. "http.status"
+	Key string
+
+	// Minimum visible width of the rendered key=value pair
+	Width int
+}
+
+// LevelStyle controls how the level of a record is rendered.
+type LevelStyle int
+
+const (
+	// LevelStyleText renders levels as three-letter labels, e.g. "INF" or
+	// "DBG-2".
+	LevelStyleText LevelStyle = iota
+
+	// LevelStyleStatusTags renders levels as colored status glyphs instead of
+	// labels: "·" for trace and debug, "•" for info, "!" for warn and "✗" for
+	// error. Level deltas are not rendered.
+	LevelStyleStatusTags
+
+	// LevelStyleFull renders levels as full uppercase names, padded to a width
+	// of five, e.g. "INFO " or "DEBUG-2".
+	LevelStyleFull
+
+	// LevelStyleChar renders levels as their first letter, e.g. "I" for info
+	// or "T" for trace. Level deltas are not rendered.
+	LevelStyleChar
+)
+
+// TimeFormatName names a common time format of the time package, see
+// Options.TimeFormatName.
+type TimeFormatName int
+
+const (
+	// TimeFormatUnset uses Options.TimeFormat.
+	TimeFormatUnset TimeFormatName = iota
+
+	TimeFormatRFC3339     // time.RFC3339, e.g. "2006-01-02T15:04:05Z07:00"
+	TimeFormatRFC3339Nano // time.RFC3339Nano, e.g. "2006-01-02T15:04:05.999999999Z07:00"
+	TimeFormatKitchen     // time.Kitchen, e.g. "3:04PM"
+	TimeFormatDateTime    // time.DateTime, e.g. "2006-01-02 15:04:05"
+	TimeFormatTimeOnly    // time.TimeOnly, e.g. "15:04:05"
+	TimeFormatStampMilli  // time.StampMilli, e.g. "Jan _2 15:04:05.000"
+)
+
+// timeFormatLayouts maps the time format names to their layouts
+var timeFormatLayouts = [...]string{
+	TimeFormatUnset:       "",
+	TimeFormatRFC3339:     time.RFC3339,
+	TimeFormatRFC3339Nano: time.RFC3339Nano,
+	TimeFormatKitchen:     time.Kitchen,
+	TimeFormatDateTime:    time.DateTime,
+	TimeFormatTimeOnly:    time.TimeOnly,
+	TimeFormatStampMilli:  time.StampMilli,
+}
+
+// layout returns the layout of the time format, or "" if it is unset or
+// unknown
+func (n TimeFormatName) layout() string {
+	if n < 0 || int(n) >= len(timeFormatLayouts) {
+		return ""
+	}
+	return timeFormatLayouts[n]
+}
+
+// NewHandler creates a [slog.Handler] that writes tinted logs to Writer w,
+// using the default options. If opts is nil, the default options are used.
+// The handler is a [*Handler], see [NewTintHandler].
+func NewHandler(w io.Writer, opts *Options) slog.Handler {
+	return NewTintHandler(w, opts)
+}
+
+// NewTintHandler is like [NewHandler], but returns the concrete [*Handler],
+// giving access to its methods, e.g. [Handler.Flush].
+func NewTintHandler(w io.Writer, opts *Options) *Handler {
+	h := &Handler{
+		mu:         new(sync.Mutex),
+		w:          w,
+		state:      new(state),
+		level:      defaultLevel,
+		timeFormat: defaultTimeFormat,
+		indent:     defaultIndent,
+		kvSep:      defaultKeyValueSeparator,
+		now:        time.Now,
+
+		levelChipPadding: defaultLevelChipPadding,
+	}
+	h.setColors(Colors{}, ProfileTrueColor)
+	if opts == nil {
+		return h
+	}
+
+	if opts.BufferWrites {
+		h.bw = bufio.NewWriter(w)
+		h.w = h.bw
+	}
+	h.addSource = opts.AddSource
+	h.sourceMinLevel = opts.SourceMinLevel
+	if opts.SourceBaseDir != "" {
+		h.sourceBaseDir = filepath.Clean(opts.SourceBaseDir)
+		if !strings.HasSuffix(h.sourceBaseDir, string(filepath.Separator)) { // e.g. the root "/"
+			h.sourceBaseDir += string(filepath.Separator)
+		}
+	}
+	if opts.Level != nil {
+		h.level = opts.Level
+	}
+	h.replaceAttr = opts.ReplaceAttr
+	if opts.TimeFormat != "" {
+		h.timeFormat = opts.TimeFormat
+	}
+	if layout := opts.TimeFormatName.layout(); layout != "" {
+		h.timeFormat = layout
+	}
+	profile := opts.ColorProfile
+	if opts.AutoColor {
+		f, _ := w.(*os.File)
+		profile = max(profile, DetectColorProfile(f)) // profiles are ordered by decreasing capability
+	}
+	h.noColor = opts.NoColor || profile == ProfileNoColor
+	colors := opts.Colors
+	if colors.Message == "" {
+		colors.Message = opts.MessageColor
+	}
+	if opts.TrueColor {
+		theme := opts.Theme
+		if theme == nil {
+			theme = DefaultTheme()
+		}
+		colors = theme.colors(colors)
+	}
+	h.setColors(colors, profile)
+	for band, level := range bandLevels {
+		if color, ok := opts.LevelColors[level]; ok {
+			h.levelColors[band] = color
+		}
+	}
+	h.valueColumn = opts.ValueColumn
+	h.valuePad = opts.ValuePad
+	h.expandJoinedErrors = opts.ExpandJoinedErrors
+	h.expandErrors = opts.ExpandErrors
+	h.errorStackTrace = opts.ErrorStackTrace
+	h.marshalJSON = opts.MarshalJSON
+	h.goSyntax = opts.GoSyntaxValues
+	h.systemdPrefix = opts.SystemdPrefix
+	h.systemdPrefixOnly = opts.SystemdPrefix && opts.SystemdPrefixOnly
+	h.dumpContext = max(opts.DumpContextOnError, 0)
+	h.timeLocation = opts.TimeLocation
+	h.annotateKeyTypes = opts.AnnotateKeyTypes
+	h.dimTail = max(opts.DimTailAttrs, 0)
+	h.levelChip = opts.LevelChip
+	h.depth = max(opts.IndentDepth, 0)
+	h.rightAlign = opts.RightAlignNumbers
+	h.bytesFormat = opts.BytesFormat
+	h.inlineGroups = opts.InlineGroups && !opts.CardMode
+	h.plainAttrTail = opts.PlainAttrTail
+	h.groupsAsJSON = opts.GroupsAsJSON
+	h.maxLinesPerSecond = max(opts.MaxLinesPerSecond, 0)
+	h.markNonMain = opts.MarkNonMainGoroutine
+	if opts.LevelChipPadding > 0 {
+		h.levelChipPadding = opts.LevelChipPadding
+	}
+	if h.timeLocation == nil && opts.UTC {
+		h.timeLocation = time.UTC
+	}
+	if len(opts.GoSyntaxKeys) > 0 {
+		h.goSyntaxKeys = make(map[string]bool, len(opts.GoSyntaxKeys))
+		for _, key := range opts.GoSyntaxKeys {
+			h.goSyntaxKeys[key] = true
+		}
+	}
+	h.errorPosition = opts.ErrorPosition
+	h.coalesceErrors = opts.CoalesceErrors
+	h.debugAttrs = opts.DebugAttrs
+	h.cardMode = opts.CardMode
+	h.highlightQuoted = opts.HighlightQuoted
+	if len(opts.ShowRate) > 0 {
+		h.showRate = make(map[string]bool, len(opts.ShowRate))
+		for _, key := range opts.ShowRate {
+			h.showRate[key] = true
+		}
+	}
+	if opts.Indent != "" {
+		h.indent = opts.Indent
+	}
+	if opts.RainbowKeys {
+		palette := opts.KeyPalette
+		if len(palette) == 0 {
+			palette = defaultKeyPalette
+		}
+		h.keyPalette = make([]string, len(palette))
+		for i, color := range palette {
+			h.keyPalette[i] = profile.convert(color)
+		}
+	}
+	h.framed = opts.FramedOutput
+	h.levelStyle = opts.LevelStyle
+	h.columns = opts.Columns
+	h.showMessageHash = opts.ShowMessageHash
+	h.timeAtEnd = opts.TimeAtEnd
+	h.maxGroupDepth = opts.MaxGroupDepth
+	h.relativeTime = opts.ShowAbsoluteAndRelativeTime
+	h.intEnums = opts.IntEnums
+	h.intEnumNameOnly = opts.IntEnumNameOnly
+	h.groupPrefixHeader = opts.GroupPrefixHeader
+	h.noTime = opts.NoTime
+	h.zeroTimeText = opts.ZeroTimeText
+	if opts.ShowUptime {
+		h.start = h.now()
+	}
+	if opts.AddMonotonic {
+		h.monoStart = h.now()
+	}
+	if opts.RelativeTime && !opts.LnavCompatible {
+		h.elapsedStart = h.now()
+	}
+	h.hideAttrs = opts.HideAttrs
+	h.coalesceGroupPrefix = opts.CoalesceGroupPrefix && !opts.CardMode && len(opts.Columns) == 0
+	h.oncePerMessage = opts.OncePerMessage
+	h.syntaxHighlight = opts.SyntaxHighlight
+	h.summaryEvery = opts.SummaryEvery
+	h.levelShortCodes = opts.LevelShortCodes
+	h.prettyStructs = opts.PrettyStructs
+	h.prettyMaxDepth = opts.PrettyStructsMaxDepth
+	h.timeFormatByLevel = opts.TimeFormatByLevel
+	h.levelLabels = opts.LevelLabels
+	h.interpolateMessage = opts.InterpolateMessage
+	h.flagAttr = opts.FlagAttr
+	h.attrDivider = opts.AttrDivider
+	h.noQuote = opts.NoQuote
+	h.replaceLevel = opts.ReplaceLevel
+	h.sourceFunction = opts.SourceFunction
+	h.keyWidth = opts.KeyWidth
+	h.reverseAttrs = opts.ReverseAttrs && !opts.SortKeys
+	h.sortKeys = opts.SortKeys
+	if opts.KeyValueSeparator != "" {
+		h.kvSep = opts.KeyValueSeparator
+	}
+	if opts.HexdumpBytes {
+		h.hexdumpThreshold = defaultHexdumpThreshold
+		if opts.HexdumpThreshold > 0 {
+			h.hexdumpThreshold = opts.HexdumpThreshold
+		}
+	}
+	if opts.LevelPipeFormat {
+		h.levelStyle = LevelStyleFull
+		h.levelPipe = true
+	}
+	h.interpolateRemoveAttrs = opts.InterpolateMessage && opts.InterpolateRemoveAttrs
+	if len(opts.DiffKeys) > 0 {
+		h.diffKeys = make(map[string]bool, len(opts.DiffKeys))
+		for _, key := range opts.DiffKeys {
+			h.diffKeys[key] = true
+		}
+	}
+	if len(opts.BadgeKeys) > 0 {
+		h.badgeKeys = make(map[string]bool, len(opts.BadgeKeys))
+		for _, key := range opts.BadgeKeys {
+			h.badgeKeys[key] = true
+		}
+		h.badgeWidth = defaultBadgeWidth
+		if opts.BadgeWidth > 0 {
+			h.badgeWidth = opts.BadgeWidth
+		}
+	}
+	if len(opts.HidePrefixGroups) > 0 {
+		h.hidePrefixGroups = make(map[string]bool, len(opts.HidePrefixGroups))
+		for _, name := range opts.HidePrefixGroups {
+			h.hidePrefixGroups[name] = true
+		}
+	}
+	if opts.AddInstanceID {
+		h.instanceID = newInstanceID()
+		h.instanceIDPerDerived = opts.InstanceIDPerDerived
+	}
+	if opts.LnavCompatible {
+		h.lnav = true
+		h.timeFormat = lnavTimeFormat
+		h.timeFormatByLevel = nil
+		h.levelLabels = nil
+		h.levelShortCodes = nil
+		h.noQuote = false
+		h.levelPipe = false
+		h.hexdumpThreshold = 0
+		h.errorStackTrace = false
+		h.systemdPrefix = false
+		h.systemdPrefixOnly = false
+		h.levelChip = false
+		h.kvSep = defaultKeyValueSeparator
+		h.keyWidth = 0
+		h.annotateKeyTypes = false
+		h.noColor = true
+		h.levelStyle = LevelStyleFull
+		h.timeAtEnd = false
+		h.relativeTime = false
+		h.start = time.Time{}
+		h.monoStart = time.Time{}
+		h.depth = 0
+		h.columns = nil
+		h.cardMode = false
+		h.groupPrefixHeader = false
+		h.coalesceGroupPrefix = false
+		h.prettyStructs = false
+		h.noTime = false
+		h.hideAttrs = false
+	}
+	h.noLevelColor = h.noColor || opts.ColorScope == ColorScopeNone
+	h.noErrorColor = h.noLevelColor || opts.ColorScope == ColorScopeLevelOnly
+	h.noColor = h.noErrorColor || opts.ColorScope == ColorScopeLevelAndErrors
+	if opts.PadTime {
+		h.timeWidths = map[string]int{h.timeFormat: opts.PadTimeWidth}
+		for _, format := range h.timeFormatByLevel {
+			h.timeWidths[format] = opts.PadTimeWidth
+		}
+		for format, width := range h.timeWidths {
+			if width <= 0 {
+				h.timeWidths[format] = maxTimeWidth(format, h.timeLocation)
+			}
+		}
+	}
+	if opts.StructuredTrailer {
+		h.trailerW = new(trailerWriter)
+		h.trailer = slog.NewTextHandler(h.trailerW, &slog.HandlerOptions{
+			AddSource:   opts.AddSource,
+			ReplaceAttr: opts.ReplaceAttr,
+		})
+	}
+	if opts.GroupDigits {
+		h.digitSeparator = opts.DigitSeparator
+		if h.digitSeparator == "" {
+			h.digitSeparator = defaultDigitSeparator
+		}
+	}
+	if opts.ColorKeysByKind {
+		h.kindKeyColors = make(map[slog.Kind]string, len(defaultKindKeyColors))
+		for kind, color := range defaultKindKeyColors {
+			h.kindKeyColors[kind] = color
+		}
+		for kind, color := range opts.KindKeyColors {
+			h.kindKeyColors[kind] = profile.convert(color)
+		}
+	}
+	if opts.HTMLOutput && !opts.LnavCompatible {
+		h.htmlOutput = true
+		h.setHTMLColors()
+		h.kindKeyColors = nil
+		h.keyPalette = nil
+		h.highlightQuoted = false
+		h.syntaxHighlight = nil
+	}
+
+	if opts.MultilineAttrs && !h.cardMode && !opts.LnavCompatible {
+		multiline := *h
+		multiline.cardMode = true
+		multiline.coalesceGroupPrefix = false
+		multiline.inlineGroups = false
+		h.multiline = &multiline
+		h.multilineThreshold = opts.MultilineThreshold
+	}
+	if opts.StartupBanner != "" {
+		_ = h.writeBanner(opts.StartupBanner) // NewHandler can't report write errors
+	}
+	return h
+}
+
+// Handler is a [slog.Handler] that writes tinted logs, created by
+// [NewTintHandler]. It is safe for concurrent use.
+type Handler struct {
+	attrsPrefix         string
+	errsPrefix          string // error attributes, if moved by Options.ErrorPosition
+	attrsPrefixSeen     int    // attributes seen for attrsPrefix and errsPrefix
+	attrsPrefixRendered int    // attributes rendered to attrsPrefix and errsPrefix
+	attrsPrefixPad      int    // padding of the last attribute of attrsPrefix
+	groupPrefix         string
+	groups              []string
+
+	mu    *sync.Mutex // guards w, shared with derived handlers
+	w     io.Writer
+	bw    *bufio.Writer // w if writes are buffered, else nil
+	state *state
+
+	addSource      bool
+	sourceMinLevel slog.Leveler
+	sourceBaseDir  string // with trailing separator, empty if unset
+	level          slog.Leveler
+	replaceAttr    func([]string, slog.Attr) slog.Attr
+	timeFormat     string
+	noColor        bool // no color for elements other than the level and errors
+	noLevelColor   bool
+	noErrorColor   bool
+	framed         bool
+	levelStyle     LevelStyle
+
+	colors        Colors
+	levelColors   [numBands]string
+	kindKeyColors map[slog.Kind]string
+	keyPalette    []string
+	columns       []Column
+
+	showMessageHash bool
+	timeAtEnd       bool
+	maxGroupDepth   int
+	relativeTime    bool
+	digitSeparator  string // empty if digits are not grouped
+	intEnums        map[string]map[int64]string
+	intEnumNameOnly bool
+
+	valueColumn        int
+	valuePad           map[string]int
+	expandJoinedErrors bool
+	expandErrors       bool
+	errorStackTrace    bool
+	marshalJSON        bool
+	goSyntax           bool
+	goSyntaxKeys       map[string]bool
+	systemdPrefix      bool
+	systemdPrefixOnly  bool
+	dumpContext        int
+	timeLocation       *time.Location // nil if times are not converted
+	annotateKeyTypes   bool
+	dimTail            int
+	levelChip          bool
+	levelChipPadding   int
+	depth              int // indentation depth of records
+	rightAlign         map[string]int
+	bytesFormat        BytesFormat
+	inlineGroups       bool
+	plainAttrTail      bool
+	groupsAsJSON       bool
+	maxLinesPerSecond  int
+	markNonMain        bool
+	lnav               bool // see Options.LnavCompatible
+	errorPosition      ErrorPosition
+	coalesceErrors     time.Duration
+	debugAttrs         bool
+	cardMode           bool
+	indent             string
+	highlightQuoted    bool
+	showRate           map[string]bool
+	noTime             bool
+	zeroTimeText       string
+	start              time.Time // zero if uptime is not shown
+	monoStart          time.Time // zero if monotonic time is not added
+	elapsedStart       time.Time // zero if the elapsed time is not rendered
+
+	coalesceGroupPrefix bool
+	oncePerMessage      bool
+	syntaxHighlight     map[string]string
+	summaryEvery        int
+	htmlOutput          bool
+	levelShortCodes     map[slog.Level]string
+
+	instanceID           string // empty if not added
+	instanceIDPerDerived bool
+
+	prettyStructs     bool
+	prettyMaxDepth    int
+	timeFormatByLevel map[slog.Level]string
+	timeWidths        map[string]int // padded widths by time format, see Options.PadTime
+	hidePrefixGroups  map[string]bool
+	levelLabels       map[slog.Level]string
+	badgeKeys         map[string]bool
+	badgeWidth        int
+	diffKeys          map[string]bool
+
+	interpolateMessage     bool
+	interpolateRemoveAttrs bool
+	flagAttr               func([]string, slog.Attr) (string, bool)
+	attrDivider            string
+	noQuote                bool
+	replaceLevel           func(slog.Level) slog.Level
+	sourceFunction         bool
+	keyWidth               int
+	reverseAttrs           bool
+	sortKeys               bool
+	hexdumpThreshold       int // 0 if disabled
+	kvSep                  string
+	levelPipe              bool
+	hideAttrs              bool
+	trailer                slog.Handler   // renders the trailer, nil if disabled
+	trailerW               *trailerWriter // writer of trailer, guarded by mu
+	groupPrefixHeader      bool
+	groupHeader            string // groups rendered as header if groupPrefixHeader is set
+	headerDepth            int    // number of groups in groupHeader, including hidden ones
+
+	multiline          *Handler // renders records in card mode, see Options.MultilineAttrs
+	multilineThreshold int
+
+	now func() time.Time // clock, replaced in tests
+}
+
+// setColors sets the colors of the handler to c, using the default colors for
+// empty fields, downgraded to the color profile p
+func (h *Handler) setColors(c Colors, p ColorProfile) {
+	def := func(color, def string) string {
+		if color == "" {
+			return def
+		}
+		return p.convert(color)
+	}
+
+	h.colors = Colors{
+		Time:     def(c.Time, ansiFaint),
+		Debug:    def(c.Debug, ansiBrightMagentaFaint),
+		Info:     def(c.Info, ansiBrightGreen),
+		Warn:     def(c.Warn, ansiBrightYellow),
+		Error:    def(c.Error, ansiBrightRed),
+		Message:  def(c.Message, ""),
+		Key:      def(c.Key, ansiFaint),
+		Value:    def(c.Value, ""),
+		Source:   def(c.Source, ansiFaint),
+		ErrorKey: def(c.ErrorKey, ansiBrightRedFaint),
+		Faint:    def(c.Faint, ansiFaint),
+	}
+
+	// by default only end the faint error key, keeping its color for the value
+	h.colors.ErrorValue = ansiResetFaint
+	if c.ErrorValue != "" {
+		h.colors.ErrorValue = ansiReset + p.convert(c.ErrorValue)
+	}
+
+	h.levelColors = [numBands]string{h.colors.Faint, h.colors.Debug, h.colors.Info, h.colors.Warn, h.colors.Error}
+}
+
+// state holds the mutable state of a handler, shared with derived handlers
+type state struct {
+	mu       sync.Mutex
+	lastTime time.Time                  // time of the last record
+	errs     map[string]*coalescedError // coalesced errors by message
+	rates    map[string]rateSample      // last values by key, see Options.ShowRate
+	diffs    map[string][]diffField     // last values by key, see Options.DiffKeys
+
+	msgs     map[string]struct{} // messages seen, see Options.OncePerMessage
+	msgOrder []string            // msgs in order of insertion, oldest at msgNext
+	msgNext  int                 // index of the oldest message once msgOrder is full
+
+	total  atomic.Int64           // records written, see Options.SummaryEvery
+	counts [numBands]atomic.Int64 // records written by level band
+
+	level atomic.Pointer[slog.Level] // set by Handler.SetLevel, nil if unset
+
+	// lines held back by Options.DumpContextOnError, oldest at heldNext once
+	// full, guarded by the write mutex of the handler
+	held     [][]byte
+	heldNext int
+
+	// token bucket of Options.MaxLinesPerSecond, guarded by the write mutex
+	// of the handler
+	tokens   float64
+	refilled time.Time // time tokens were last refilled, zero if never
+	dropped  int       // lines dropped since the last written line
+}
+
+// holdLine holds back a copy of a line, dropping the oldest line if n lines
+// are held already
+func (s *state) holdLine(line []byte, n int) {
+	line = slices.Clone(line)
+	if len(s.held) < n {
+		s.held = append(s.held, line)
+		return
+	}
+	s.held[s.heldNext] = line
+	s.heldNext = (s.heldNext + 1) % n
+}
+
+// takeToken refills the token bucket at rate tokens per second up to rate and
+// takes a token. It returns false if the bucket is empty and the line must be
+// dropped, else the number of lines dropped since the last taken token.
+func (s *state) takeToken(now time.Time, rate int) (dropped int, ok bool) {
+	if s.refilled.IsZero() {
+		s.tokens = float64(rate)
+	} else {
+		s.tokens = min(s.tokens+now.Sub(s.refilled).Seconds()*float64(rate), float64(rate))
+	}
+	s.refilled = now
+
+	if s.tokens < 1 {
+		s.dropped++
+		return 0, false
+	}
+	s.tokens--
+	dropped, s.dropped = s.dropped, 0
+	return dropped, true
+}
+
+// takeHeld returns the held lines from oldest to newest and forgets them
+func (s *state) takeHeld() [][]byte {
+	lines := make([][]byte, 0, len(s.held))
+	lines = append(lines, s.held[s.heldNext:]...)
+	lines = append(lines, s.held[:s.heldNext]...)
+	s.held, s.heldNext = nil, 0
+	return lines
+}
+
+// maxOnceMessages bounds the number of messages remembered for
+// Options.OncePerMessage
+const maxOnceMessages = 4096
+
+// seenMessage records the message and returns true if it has been seen before
+func (s *state) seenMessage(msg string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.msgs[msg]; ok {
+		return true
+	}
+	if s.msgs == nil {
+		s.msgs = make(map[string]struct{})
+	}
+
+	// forget the oldest message if full
+	if len(s.msgOrder) < maxOnceMessages {
+		s.msgOrder = append(s.msgOrder, msg)
+	} else {
+		delete(s.msgs, s.msgOrder[s.msgNext])
+		s.msgOrder[s.msgNext] = msg
+		s.msgNext = (s.msgNext + 1) % maxOnceMessages
+	}
+	s.msgs[msg] = struct{}{}
+	return false
+}
+
+// rateSample is a logged value of a key and the time it was logged at
+type rateSample struct {
+	t time.Time
+	v float64
+}
+
+// coalescedError tracks the occurrences of an error message within the
+// coalescing window, see Options.CoalesceErrors
+type coalescedError struct {
+	start time.Time // start of the window
+	count int       // occurrences within the window
+}
+
+// maxCoalescedErrors bounds the number of error messages tracked for
+// coalescing. Errors beyond the bound are not coalesced.
+const maxCoalescedErrors = 1024
+
+// clone returns a shallow copy of the handler
+func (h *Handler) clone() *Handler {
+	h2 := *h
+	if h.instanceIDPerDerived {
+		h2.instanceID = newInstanceID()
+	}
+	return &h2
+}
+
+// mainGoroutine is the ID of the goroutine that initialized the package,
+// assumed to be the main goroutine, see Options.MarkNonMainGoroutine
+var mainGoroutine = goroutineID()
+
+// goroutineID returns the ID of the current goroutine, parsed from the header
+// "goroutine N [status]:" of its stack trace, or 0 if it can't be parsed
+func goroutineID() uint64 {
+	var b [64]byte
+	header := b[:runtime.Stack(b[:], false)]
+	header, _ = bytes.CutPrefix(header, []byte("goroutine "))
+	header, _, _ = bytes.Cut(header, []byte(" "))
+	id, _ := strconv.ParseUint(string(header), 10, 64)
+	return id
+}
+
+// newInstanceID returns a random ID of 6 hex digits
+func newInstanceID() string {
+	var b [3]byte
+	_, _ = rand.Read(b[:]) // never returns an error
+	return hex.EncodeToString(b[:])
+}
+
+// Enabled returns true if the level is enabled
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.GetLevel()
+}
+
+// SetLevel sets the minimum level of records to log, overriding Options.Level
+// from then on. It affects the handler and all handlers derived from it or
+// from the same handler with WithAttrs and WithGroup, and is safe for
+// concurrent use with logging, e.g. from a signal handler.
+func (h *Handler) SetLevel(level slog.Level) {
+	h.state.level.Store(&level)
+}
+
+// GetLevel returns the minimum level of records to log, set by SetLevel or
+// Options.Level
+func (h *Handler) GetLevel() slog.Level {
+	if level := h.state.level.Load(); level != nil {
+		return *level
+	}
+	return h.level.Level()
+}
+
+// Handle writes a log record to the handler's writer
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if h.multiline != nil && h.numAttrs(r) > h.multilineThreshold {
+		return h.multiline.Handle(ctx, r)
+	}
+	if h.oncePerMessage && h.state.seenMessage(r.Message) {
+		return nil
+	}
+
+	// get a buffer from the sync pool
+	buf := newBuffer()
+	defer buf.Free()
+
+	// reserve space for the frame length
+	if h.framed {
+		buf.WriteString("\x00\x00\x00\x00")
+	}
+
+	// coalesce repeated errors
+	var errCount int
+	if h.coalesceErrors > 0 {
+		if msg, ok := recordError(r); ok {
+			var suppress bool
+			if errCount, suppress = h.coalesceError(msg); suppress {
+				return nil
+			}
+		}
+	}
+
+	rep := h.replaceAttr
+
+	// write systemd priority
+	if h.systemdPrefix {
+		buf.WriteString(bandPriorities[levelBand(h.renderedLevel(r.Level))])
+	}
+
+	// write indentation
+	for i := 0; i < h.depth; i++ {
+		buf.WriteString(h.indent)
+	}
+
+	// write time
+	if !h.timeAtEnd {
+		h.appendRecordTime(buf, r.Time, r.Level)
+	}
+
+	// write uptime
+	if !h.start.IsZero() {
+		buf.WriteStringIf(!h.noColor, h.colors.Faint)
+		buf.WriteString("uptime=")
+		buf.WriteString(h.now().Sub(h.start).Truncate(time.Millisecond).String())
+		buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+		buf.WriteChar(' ')
+	}
+
+	// write monotonic time
+	if !h.monoStart.IsZero() {
+		buf.WriteStringIf(!h.noColor, h.colors.Faint)
+		buf.WriteString("mono=")
+		*buf = strconv.AppendInt(*buf, h.now().Sub(h.monoStart).Nanoseconds(), 10)
+		buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+		buf.WriteChar(' ')
+	}
+
+	// write level, unless the systemd priority carries it
+	if !h.systemdPrefixOnly {
+		if rep == nil {
+			h.appendLevel(buf, h.renderedLevel(r.Level))
+			buf.WriteChar(' ')
+			h.appendLevelPipe(buf, h.renderedLevel(r.Level))
+		} else if a := rep(nil /* groups */, slog.Any(slog.LevelKey, r.Level)); a.Key != "" {
+			h.appendValue(buf, a.Value, false)
+			buf.WriteChar(' ')
+			h.appendLevelPipe(buf, h.renderedLevel(r.Level))
+		}
+	}
+
+	// write instance ID
+	if h.instanceID != "" {
+		buf.WriteStringIf(!h.noColor, h.colors.Faint)
+		buf.WriteString("inst=")
+		buf.WriteString(h.instanceID)
+		buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+		buf.WriteChar(' ')
+	}
+
+	// write group header
+	if len(h.groupHeader) > 0 {
+		buf.WriteStringIf(!h.noColor, h.colors.Faint)
+		buf.WriteChar('[')
+		buf.WriteString(h.groupHeader[:len(h.groupHeader)-1])
+		buf.WriteChar(']')
+		buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+		buf.WriteChar(' ')
+	}
+
+	// write source
+	if h.addSource && (h.sourceMinLevel == nil || r.Level >= h.sourceMinLevel.Level()) {
+		fs := runtime.CallersFrames([]uintptr{r.PC})
+		f, _ := fs.Next()
+		if f.File != "" {
+			src := &slog.Source{
+				Function: f.Function,
+				File:     f.File,
+				Line:     f.Line,
+			}
+
+			if rep == nil {
+				h.appendSource(buf, src)
+				buf.WriteChar(' ')
+			} else if a := rep(nil /* groups */, slog.Any(slog.SourceKey, src)); a.Key != "" {
+				h.appendValue(buf, a.Value, false)
+				buf.WriteChar(' ')
+			}
+		}
+	}
+
+	// write marker of background goroutines
+	if h.markNonMain && goroutineID() != mainGoroutine {
+		buf.WriteStringIf(!h.noColor, h.colors.Faint)
+		buf.WriteString("[bg]")
+		buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+		buf.WriteChar(' ')
+	}
+
+	// write message
+	var s attrState
+	if rep == nil {
+		buf.WriteStringIf(!h.noColor, h.colors.Message)
+		h.appendMessage(buf, r.Message, r, &s)
+		buf.WriteStringIf(!h.noColor && h.colors.Message != "", ansiReset)
+		buf.WriteChar(' ')
+	} else if a := rep(nil /* groups */, slog.String(slog.MessageKey, r.Message)); a.Key != "" {
+		buf.WriteStringIf(!h.noColor, h.colors.Message)
+		if a.Value.Kind() == slog.KindString {
+			h.appendMessage(buf, a.Value.String(), r, &s)
+		} else {
+			h.appendValue(buf, a.Value, false)
+		}
+		buf.WriteStringIf(!h.noColor && h.colors.Message != "", ansiReset)
+		buf.WriteChar(' ')
+	}
+
+	// write attributes
+	attrsStart := len(*buf)
+	ah := h.attrsHandler()
+	var pad int // padding of the last attribute
+	switch {
+	case h.hideAttrs:
+		// attributes are omitted
+	case h.errorPosition == ErrorsFirst:
+		s.errs = newBuffer()
+		defer s.errs.Free()
+		rest := newBuffer()
+		defer rest.Free()
+
+		ah.appendAttrs(rest, r, &s)
+		pad = s.trailingPad(rest)
+		buf.WriteString(h.errsPrefix)
+		*buf = append(*buf, *s.errs...)
+		*buf = append(*buf, *rest...)
+	case h.errorPosition == ErrorsLast:
+		s.errs = newBuffer()
+		defer s.errs.Free()
+
+		ah.appendAttrs(buf, r, &s)
+		if len(h.errsPrefix) == 0 && len(*s.errs) == 0 {
+			pad = s.trailingPad(buf)
+		}
+		buf.WriteString(h.errsPrefix)
+		*buf = append(*buf, *s.errs...)
+	default:
+		ah.appendAttrs(buf, r, &s)
+		pad = s.trailingPad(buf)
+	}
+
+	// write the occurrences of a coalesced error
+	if errCount > 1 {
+		var s attrState
+		ah.appendAttr(buf, slog.Int("count", errCount), h.groupPrefix, h.groups, &s)
+		ah.flushRun(&s)
+		pad = s.trailingPad(buf)
+	}
+
+	// drop the padding of the last attribute
+	if pad > 0 && !h.cardMode {
+		*buf = append((*buf)[:len(*buf)-1-pad], ' ')
+	}
+
+	if h.cardMode {
+		h.indentAttrs(buf, attrsStart)
+	}
+
+	// write attribute counts
+	if h.debugAttrs {
+		buf.WriteStringIf(!h.noColor, h.colors.Faint)
+		buf.WriteString("(rendered ")
+		*buf = strconv.AppendInt(*buf, int64(h.attrsPrefixRendered+s.rendered), 10)
+		buf.WriteChar('/')
+		*buf = strconv.AppendInt(*buf, int64(h.attrsPrefixSeen+s.seen), 10)
+		buf.WriteChar(')')
+		buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+		buf.WriteChar(' ')
+	}
+
+	// write message hash
+	if h.showMessageHash {
+		buf.WriteStringIf(!h.noColor, h.colors.Faint)
+		buf.WriteString("msgid=")
+		appendMessageHash(buf, r.Message)
+		buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+		buf.WriteChar(' ')
+	}
+
+	// write time at the end of the line
+	if h.timeAtEnd {
+		h.appendRecordTime(buf, r.Time, r.Level)
+	}
+
+	// write structured trailer
+	if h.trailer != nil {
+		if err := h.appendTrailer(ctx, buf, r); err != nil {
+			return err
+		}
+	}
+
+	if err := h.writeRecordLine(buf, r.Level); err != nil {
+		return err
+	}
+
+	// write summary
+	if h.summaryEvery > 0 {
+		h.state.counts[levelBand(r.Level)].Add(1)
+		if n := h.state.total.Add(1); n%int64(h.summaryEvery) == 0 {
+			return h.writeSummary(n)
+		}
+	}
+	return nil
+}
+
+// writeSummary writes a faint summary line with the total number of records
+// and the number of records per level band
+func (h *Handler) writeSummary(total int64) error {
+	buf := newBuffer()
+	defer buf.Free()
+
+	if h.framed {
+		buf.WriteString("\x00\x00\x00\x00")
+	}
+
+	buf.WriteStringIf(!h.noColor, h.colors.Faint)
+	buf.WriteString("…")
+	*buf = strconv.AppendInt(*buf, total, 10)
+	buf.WriteString(" records:")
+	sep := " "
+	for band := range h.state.counts {
+		n := h.state.counts[band].Load()
+		if n == 0 {
+			continue
+		}
+		buf.WriteString(sep)
+		*buf = strconv.AppendInt(*buf, n, 10)
+		buf.WriteChar(' ')
+		buf.WriteString(bandLabels[band])
+		sep = ", "
+	}
+	buf.WriteString(" so far")
+	buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+	buf.WriteChar(' ')
+
+	return h.writeLine(buf)
+}
+
+// indentAttrs moves each attribute appended to the buffer since start, as
+// ended by appendAttrEnd in card mode, to its own indented line
+func (h *Handler) indentAttrs(buf *buffer, start int) {
+	if len(*buf) == start {
+		return
+	}
+
+	attrs := newBuffer()
+	defer attrs.Free()
+	*attrs = append(*attrs, (*buf)[start:]...)
+
+	// drop the space ending the header line
+	*buf = (*buf)[:start]
+	if start > 0 && (*buf)[start-1] == ' ' {
+		*buf = (*buf)[:start-1]
+	}
+
+	for _, attr := range bytes.Split((*attrs)[:len(*attrs)-1], []byte{'\n'}) {
+		buf.WriteChar('\n')
+		buf.WriteString(h.indent)
+		*buf = append(*buf, attr...)
+	}
+	buf.WriteChar(' ')
+}
+
+// appendTrailer escapes the record separators in the buffer and appends the
+// record separator and the record in logfmt to it, ending with a newline in
+// place of a space
+func (h *Handler) appendTrailer(ctx context.Context, buf *buffer, r slog.Record) error {
+	if bytes.IndexByte(*buf, '\x1e') >= 0 {
+		*buf = bytes.ReplaceAll(*buf, []byte{'\x1e'}, []byte(`\x1e`))
+	}
+	buf.WriteChar('\x1e')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.trailerW.buf = buf
+	defer func() { h.trailerW.buf = nil }()
+	return h.trailer.Handle(ctx, r)
+}
+
+// trailerWriter appends the output of the trailer handler to a buffer
+type trailerWriter struct {
+	buf *buffer
+}
+
+// Write appends p to the buffer
+func (w *trailerWriter) Write(p []byte) (int, error) {
+	*w.buf = append(*w.buf, p...)
+	return len(p), nil
+}
+
+// writeLine terminates the line in the buffer, which ends with a space, and
+// writes it to the handler's writer. Empty lines are not written.
+func (h *Handler) writeLine(buf *buffer) error {
+	if !h.finishLine(buf) {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := h.w.Write(*buf)
+	return err
+}
+
+// Flush writes the output buffered by Options.BufferWrites to the writer of the
+// handler. It does nothing if writes are not buffered.
+func (h *Handler) Flush() error {
+	if h.bw == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.bw.Flush()
+}
+
+// writeRecordLine writes the line of a record of the level like writeLine. If
+// Options.MaxLinesPerSecond is set, lines exceeding the rate are dropped. If
+// Options.DumpContextOnError is set, lines below the error level are held
+// back, and error lines are preceded by the held lines.
+func (h *Handler) writeRecordLine(buf *buffer, level slog.Level) error {
+	if h.dumpContext == 0 && h.maxLinesPerSecond == 0 {
+		return h.writeLine(buf)
+	}
+	if !h.finishLine(buf) {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.maxLinesPerSecond > 0 {
+		dropped, ok := h.state.takeToken(h.now(), h.maxLinesPerSecond)
+		if !ok {
+			return nil
+		}
+		if dropped > 0 {
+			if err := h.writeDropped(dropped); err != nil {
+				return err
+			}
+		}
+	}
+
+	if h.dumpContext == 0 {
+		_, err := h.w.Write(*buf)
+		return err
+	}
+	if level < slog.LevelError {
+		h.state.holdLine(*buf, h.dumpContext)
+		return nil
+	}
+	for _, line := range h.state.takeHeld() {
+		if _, err := h.w.Write(line); err != nil {
+			return err
+		}
+	}
+	_, err := h.w.Write(*buf)
+	return err
+}
+
+// writeDropped writes a faint notice of n lines dropped by
+// Options.MaxLinesPerSecond. The write mutex of the handler must be held.
+func (h *Handler) writeDropped(n int) error {
+	buf := newBuffer()
+	defer buf.Free()
+
+	if h.framed {
+		buf.WriteString("\x00\x00\x00\x00")
+	}
+
+	buf.WriteStringIf(!h.noColor, h.colors.Faint)
+	buf.WriteString("dropped ")
+	*buf = strconv.AppendInt(*buf, int64(n), 10)
+	buf.WriteString(" lines")
+	buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+	buf.WriteChar(' ')
+
+	h.finishLine(buf)
+	_, err := h.w.Write(*buf)
+	return err
+}
+
+// finishLine converts the buffer to HTML and frames it if enabled, or
+// replaces the last space with a newline. It returns false if the line is
+// empty and must not be written.
+func (h *Handler) finishLine(buf *buffer) bool {
+	if h.htmlOutput {
+		start := 0
+		if h.framed {
+			start = 4
+		}
+		toHTML(buf, start)
+	}
+
+	if h.framed {
+		if len(*buf) == 4 {
+			return false
+		}
+		*buf = (*buf)[:len(*buf)-1] // drop last space
+		binary.LittleEndian.PutUint32(*buf, uint32(len(*buf)-4))
+	} else {
+		if len(*buf) == 0 {
+			return false
+		}
+		(*buf)[len(*buf)-1] = '\n' // replace last space with newline
+	}
+	return true
+}
+
+// writeBanner writes a faint banner line marking the start of a session with
+// the title, process ID and current time
+func (h *Handler) writeBanner(title string) error {
+	buf := newBuffer()
+	defer buf.Free()
+
+	if h.framed {
+		buf.WriteString("\x00\x00\x00\x00")
+	}
+
+	buf.WriteStringIf(!h.noColor, h.colors.Faint)
+	buf.WriteString("--- ")
+	buf.WriteString(title)
+	buf.WriteString(" pid=")
+	*buf = strconv.AppendInt(*buf, int64(os.Getpid()), 10)
+	buf.WriteChar(' ')
+	now := h.now()
+	if h.timeLocation != nil {
+		now = now.In(h.timeLocation)
+	}
+	*buf = now.AppendFormat(*buf, h.timeFormat)
+	buf.WriteString(" ---")
+	buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+	buf.WriteChar(' ')
+
+	return h.writeLine(buf)
+}
+
+// appendAttrs appends the handler attributes and the record attributes to the
+// buffer
+func (h *Handler) appendAttrs(buf *buffer, r slog.Record, s *attrState) {
+	if len(h.columns) > 0 && !h.cardMode {
+		h.appendColumns(buf, r, s)
+		return
+	}
+
+	// write handler attributes
+	if len(h.attrsPrefix) > 0 {
+		buf.WriteString(h.attrsPrefix)
+		s.setPad(buf, h.attrsPrefixPad)
+	}
+
+	// write record attributes
+	start := len(*buf)
+	h.recordAttrs(r, func(attr slog.Attr) {
+		h.appendAttr(buf, attr, h.groupPrefix, h.groups, s)
+	})
+	h.flushRun(s)
+
+	// write divider before the record attributes
+	if h.attrDivider != "" && len(*buf) > start {
+		div := newBuffer()
+		defer div.Free()
+		div.WriteStringIf(!h.noColor, h.colors.Faint)
+		div.WriteString(h.attrDivider)
+		div.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+		div.WriteChar(' ')
+		*buf = slices.Insert(*buf, start, *div...)
+		s.padEnd += len(*div)
+	}
+}
+
+// recordAttrs calls f for each record attribute, sorted if Options.SortKeys is
+// set or in reverse order if Options.ReverseAttrs is set
+func (h *Handler) recordAttrs(r slog.Record, f func(slog.Attr)) {
+	if !h.reverseAttrs && !h.sortKeys {
+		r.Attrs(func(attr slog.Attr) bool {
+			f(attr)
+			return true
+		})
+		return
+	}
+
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+	if h.sortKeys {
+		for _, attr := range h.sortAttrs(attrs) {
+			f(attr)
+		}
+		return
+	}
+	for i := len(attrs) - 1; i >= 0; i-- {
+		f(attrs[i])
+	}
+}
+
+// sortAttrs returns the attributes sorted stably by key if Options.SortKeys is
+// set, or as is otherwise
+func (h *Handler) sortAttrs(attrs []slog.Attr) []slog.Attr {
+	if !h.sortKeys || slices.IsSortedFunc(attrs, compareAttrKeys) {
+		return attrs
+	}
+	attrs = slices.Clone(attrs)
+	slices.SortStableFunc(attrs, compareAttrKeys)
+	return attrs
+}
+
+// compareAttrKeys compares the keys of two attributes
+func compareAttrKeys(a, b slog.Attr) int {
+	return strings.Compare(a.Key, b.Key)
+}
+
+// appendColumns appends the record attributes in columns, followed by the
+// handler attributes and the remaining record attributes
+func (h *Handler) appendColumns(buf *buffer, r slog.Record, s *attrState) {
+	cells := make([]*buffer, len(h.columns))
+	for i := range cells {
+		cells[i] = newBuffer()
+		defer cells[i].Free()
+	}
+	tail := newBuffer()
+	defer tail.Free()
+
+	h.recordAttrs(r, func(attr slog.Attr) {
+		h.appendColumnAttr(cells, tail, attr, h.groupPrefix, h.groups, s)
+	})
+
+	for i, col := range h.columns {
+		cell := *cells[i]
+		if len(cell) > 0 {
+			cell = cell[:len(cell)-1] // drop last space
+		}
+		*buf = append(*buf, cell...)
+		appendPadding(buf, col.Width-visibleWidth(cell))
+		buf.WriteChar(' ')
+	}
+
+	buf.WriteString(h.attrsPrefix)
+	*buf = append(*buf, *tail...)
+}
+
+// appendColumnAttr appends an attribute to its column cell, if it has one and
+// the cell is still empty, or to the tail otherwise
+func (h *Handler) appendColumnAttr(cells []*buffer, tail *buffer, attr slog.Attr, groupsPrefix string, groups []string, s *attrState) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			groupsPrefix += attr.Key + "."
+			groups = append(groups, attr.Key)
+		}
+		for _, groupAttr := range h.sortAttrs(attr.Value.Group()) {
+			h.appendColumnAttr(cells, tail, groupAttr, groupsPrefix, groups, s)
+		}
+		return
+	}
+
+	for i, col := range h.columns {
+		if col.Key == groupsPrefix+attr.Key && len(*cells[i]) == 0 {
+			h.appendAttr(cells[i], attr, groupsPrefix, groups, s)
+			return
+		}
+	}
+	h.appendAttr(tail, attr, groupsPrefix, groups, s)
+}
+
+// attrsHandler returns the handler rendering the attributes, which is a copy of
+// h without colors if Options.PlainAttrTail is set
+func (h *Handler) attrsHandler() *Handler {
+	if !h.plainAttrTail {
+		return h
+	}
+	return h.plainHandler()
+}
+
+// plainHandler returns a copy of h without colors
+func (h *Handler) plainHandler() *Handler {
+	plain := *h
+	plain.noColor, plain.noLevelColor, plain.noErrorColor = true, true, true
+	return &plain
+}
+
+// WithAttrs returns a new handler with the given attributes
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := h.clone()
+
+	buf := newBuffer()
+	defer buf.Free()
+
+	var s attrState
+	if h.errorPosition != ErrorsInline {
+		s.errs = newBuffer()
+		defer s.errs.Free()
+	}
+
+	// write attributes to buffer
+	ah := h.attrsHandler()
+	for _, attr := range h.sortAttrs(attrs) {
+		ah.appendAttr(buf, attr, h.groupPrefix, h.groups, &s)
+	}
+	ah.flushRun(&s)
+	h2.attrsPrefix = h.attrsPrefix + string(*buf)
+	if len(*buf) > 0 {
+		h2.attrsPrefixPad = s.trailingPad(buf)
+	}
+	if s.errs != nil {
+		h2.errsPrefix = h.errsPrefix + string(*s.errs)
+	}
+	h2.attrsPrefixSeen += s.seen
+	h2.attrsPrefixRendered += s.rendered
+	if h.trailer != nil {
+		h2.trailer = h.trailer.WithAttrs(attrs)
+	}
+	if h.multiline != nil {
+		h2.multiline = h.multiline.WithAttrs(attrs).(*Handler)
+		h2.multiline.instanceID = h2.instanceID
+	}
+	return h2
+}
+
+// WithGroup returns a new handler with the given group name
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := h.clone()
+	if h.groupPrefixHeader && h.headerDepth == len(h.groups) && h.attrsPrefix == "" && h.errsPrefix == "" {
+		// no attributes outside of the group yet
+		if !h.hidePrefixGroups[name] {
+			h2.groupHeader += name + "."
+		}
+		h2.headerDepth++
+	} else {
+		h2.groupPrefix += name + "."
+	}
+	h2.groups = append(h2.groups, name)
+	if h.trailer != nil {
+		h2.trailer = h.trailer.WithGroup(name)
+	}
+	if h.multiline != nil {
+		h2.multiline = h.multiline.WithGroup(name).(*Handler)
+		h2.multiline.instanceID = h2.instanceID
+	}
+	return h2
+}
+
+// WithIndent returns a new handler whose records are indented one level deeper
+// than the records of h, see Options.IndentDepth. It returns h if
+// Options.LnavCompatible is set.
+func (h *Handler) WithIndent() *Handler {
+	if h.lnav {
+		return h // lines must start with the time
+	}
+	h2 := h.clone()
+	h2.depth++
+	if h.multiline != nil {
+		h2.multiline = h.multiline.WithIndent()
+		h2.multiline.instanceID = h2.instanceID
+	}
+	return h2
+}
+
+// appendRecordTime appends the time of a record of the level followed by a
+// space to the buffer, unless it is zero or dropped by ReplaceAttr
+func (h *Handler) appendRecordTime(buf *buffer, t time.Time, level slog.Level) {
+	if t.IsZero() || h.noTime {
+		return
+	}
+
+	val := t.Round(0) // strip monotonic to match Attr behavior
+	if h.replaceAttr == nil {
+		h.appendTime(buf, t, level)
+	} else if a := h.replaceAttr(nil /* groups */, slog.Time(slog.TimeKey, val)); a.Key != "" {
+		if a.Value.Kind() == slog.KindTime {
+			h.appendTime(buf, a.Value.Time(), level)
+		} else {
+			h.appendValue(buf, a.Value, false)
+		}
+	} else {
+		return
+	}
+	buf.WriteChar(' ')
+
+	if h.relativeTime {
+		h.appendTimeDelta(buf, t)
+		buf.WriteChar(' ')
+	}
+}
+
+// appendTimeDelta appends the duration since the time of the previous record
+// to the buffer, e.g. "(+12ms)"
+func (h *Handler) appendTimeDelta(buf *buffer, t time.Time) {
+	h.state.mu.Lock()
+	var delta time.Duration
+	if !h.state.lastTime.IsZero() {
+		delta = t.Sub(h.state.lastTime)
+	}
+	h.state.lastTime = t
+	h.state.mu.Unlock()
+
+	buf.WriteStringIf(!h.noColor, h.colors.Faint)
+	buf.WriteChar('(')
+	if delta >= 0 {
+		buf.WriteChar('+')
+	}
+	buf.WriteString(delta.String())
+	buf.WriteChar(')')
+	buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+}
+
+// appendElapsed appends the time elapsed from the creation of the handler to t
+// to the buffer, e.g. "+1.234s"
+func (h *Handler) appendElapsed(buf *buffer, t time.Time) {
+	d := t.Sub(h.elapsedStart).Truncate(time.Millisecond)
+	buf.WriteStringIf(!h.noColor, h.colors.Faint)
+	if d >= 0 {
+		buf.WriteChar('+')
+	}
+	buf.WriteString(d.String())
+	buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+}
+
+// recordError returns the message of the first error attribute of the record
+func recordError(r slog.Record) (msg string, ok bool) {
+	r.Attrs(func(attr slog.Attr) bool {
+		if err, isErr := attr.Value.Resolve().Any().(error); isErr {
+			msg, ok = err.Error(), true
+			return false
+		}
+		return true
+	})
+	return msg, ok
+}
+
+// coalesceError records an occurrence of the error message. It returns true if
+// the record is a duplicate within the coalescing window and is to be
+// suppressed. Otherwise it returns the number of occurrences within the
+// previous window, if any.
+func (h *Handler) coalesceError(msg string) (count int, suppress bool) {
+	now := h.now()
+
+	h.state.mu.Lock()
+	defer h.state.mu.Unlock()
+
+	e, ok := h.state.errs[msg]
+	if ok && now.Sub(e.start) < h.coalesceErrors {
+		e.count++
+		return 0, true
+	}
+	if ok {
+		count = e.count
+	} else if len(h.state.errs) >= maxCoalescedErrors {
+		// evict errors with an expired window
+		for m, e := range h.state.errs {
+			if now.Sub(e.start) >= h.coalesceErrors {
+				delete(h.state.errs, m)
+			}
+		}
+		if len(h.state.errs) >= maxCoalescedErrors {
+			return 0, false
+		}
+	}
+
+	if h.state.errs == nil {
+		h.state.errs = make(map[string]*coalescedError)
+	}
+	h.state.errs[msg] = &coalescedError{start: now, count: 1}
+	return count, false
+}
+
+// appendTime appends the time of a record of the level to the buffer
+func (h *Handler) appendTime(buf *buffer, t time.Time, level slog.Level) {
+	if !h.elapsedStart.IsZero() {
+		h.appendElapsed(buf, t)
+		return
+	}
+
+	format := h.timeFormatFor(level)
+	if h.timeLocation != nil {
+		t = t.In(h.timeLocation)
+	}
+	buf.WriteStringIf(!h.noColor, h.colors.Time)
+	start := len(*buf)
+	*buf = t.AppendFormat(*buf, format)
+	width := visibleWidth((*buf)[start:])
+	buf.WriteStringIf(!h.noColor, resetFor(h.colors.Time))
+	if padded, ok := h.timeWidths[format]; ok {
+		appendPadding(buf, padded-width)
+	}
+}
+
+// maxTimeWidth returns the visible width of the widest time of the format in
+// the location, e.g. "12:00PM" for time.Kitchen. If loc is nil, times may be
+// in any location, so the width is measured with a numeric zone offset, which
+// is wider than "Z" of UTC.
+func maxTimeWidth(format string, loc *time.Location) int {
+	if loc == nil {
+		loc = time.FixedZone("-0930", -(9*60+30)*60)
+	}
+	// a Wednesday in September with two-digit day and 12-hour clock hour, and
+	// nanoseconds without trailing zeros
+	t := time.Date(2023, time.September, 27, 22, 58, 58, 987654321, loc)
+	return visibleWidth(t.AppendFormat(nil, format))
+}
+
+// timeFormatFor returns the time format of records of the level
+func (h *Handler) timeFormatFor(level slog.Level) string {
+	if format, ok := h.timeFormatByLevel[level]; ok {
+		return format
+	}
+	if format, ok := h.timeFormatByLevel[bandLevels[levelBand(level)]]; ok {
+		return format
+	}
+	return h.timeFormat
+}
+
+// level bands, from lowest to highest
+const (
+	bandTrace = iota
+	bandDebug
+	bandInfo
+	bandWarn
+	bandError
+	numBands
+)
+
+var (
+	// bandLevels holds the lowest level of each band, used to compute deltas
+	bandLevels = [numBands]slog.Level{slog.LevelDebug - 4, slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+	bandLabels = [numBands]string{"TRC", "DBG", "INF", "WRN", "ERR"}
+	bandGlyphs = [numBands]string{"·", "·", "•", "!", "✗"}
+	bandNames  = [numBands]string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR"}
+
+	// syslog priorities of the bands understood by the systemd journal
+	bandPriorities = [numBands]string{"<7>", "<7>", "<6>", "<4>", "<3>"}
+)
+
+// levelBand returns the band of a level
+func levelBand(level slog.Level) int {
+	switch {
+	case level <= slog.LevelDebug-4:
+		return bandTrace
+	case level < slog.LevelInfo:
+		return bandDebug
+	case level < slog.LevelWarn:
+		return bandInfo
+	case level < slog.LevelError:
+		return bandWarn
+	default:
+		return bandError
+	}
+}
+
+// appendLevel appends a level to the buffer
+func (h *Handler) appendLevel(buf *buffer, level slog.Level) {
+	band := levelBand(level)
+
+	buf.WriteStringIf(!h.noLevelColor, h.levelColors[band])
+	code, ok := h.levelShortCodes[level]
+	switch {
+	case ok:
+		buf.WriteString(code)
+	case h.levelChip:
+		var padding int
+		if !h.noLevelColor {
+			buf.WriteString(ansiReverse)
+			padding = h.levelChipPadding
+		}
+		appendPadding(buf, padding)
+		start := len(*buf)
+		h.appendLevelLabel(buf, level, bandNames[band])
+		appendPadding(buf, 5-visibleWidth((*buf)[start:]))
+		appendPadding(buf, padding)
+	case h.levelStyle == LevelStyleStatusTags:
+		buf.WriteString(bandGlyphs[band])
+	case h.levelStyle == LevelStyleChar:
+		buf.WriteString(bandNames[band][:1])
+	case h.levelStyle == LevelStyleFull:
+		start := len(*buf)
+		h.appendLevelLabel(buf, level, bandNames[band])
+		appendPadding(buf, 5-visibleWidth((*buf)[start:]))
+	default:
+		h.appendLevelLabel(buf, level, bandLabels[band])
+	}
+	buf.WriteStringIf(!h.noLevelColor, ansiReset)
+}
+
+// appendLevelPipe appends the pipe following the level of a record to the
+// buffer, if Options.LevelPipeFormat is set
+func (h *Handler) appendLevelPipe(buf *buffer, level slog.Level) {
+	if !h.levelPipe {
+		return
+	}
+	buf.WriteStringIf(!h.noLevelColor, h.levelColors[levelBand(level)])
+	buf.WriteChar('|')
+	buf.WriteStringIf(!h.noLevelColor, ansiReset)
+	buf.WriteChar(' ')
+}
+
+// renderedLevel returns the level rendered for a level, see
+// Options.ReplaceLevel
+func (h *Handler) renderedLevel(level slog.Level) slog.Level {
+	if h.replaceLevel == nil {
+		return level
+	}
+	return h.replaceLevel(level)
+}
+
+// appendLevelLabel appends the label of a level to the buffer, which is its
+// label from Options.LevelLabels or the label of its band followed by the delta,
+// using bandLabel for bands without a label
+func (h *Handler) appendLevelLabel(buf *buffer, level slog.Level, bandLabel string) {
+	if label, ok := h.levelLabels[level]; ok {
+		buf.WriteString(label)
+		return
+	}
+	bandLevel := bandLevels[levelBand(level)]
+	if label, ok := h.levelLabels[bandLevel]; ok {
+		bandLabel = label
+	}
+	buf.WriteString(bandLabel)
+	appendLevelDelta(buf, level-bandLevel)
+}
+
+// appendLevelDelta appends a level delta to the buffer
+func appendLevelDelta(buf *buffer, delta slog.Level) {
+	if delta == 0 {
+		return
+	} else if delta > 0 {
+		buf.WriteChar('+')
+	}
+	*buf = strconv.AppendInt(*buf, int64(delta), 10)
+}
+
+// appendMessage appends a message to the buffer, replacing references to
+// record attributes by their values if Options.InterpolateMessage is set
+func (h *Handler) appendMessage(buf *buffer, msg string, r slog.Record, s *attrState) {
+	if !h.interpolateMessage {
+		buf.WriteString(msg)
+		return
+	}
+
+	for {
+		start := strings.IndexByte(msg, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(msg[start+1:], '}')
+		if end < 0 {
+			break
+		}
+		end += start + 1
+
+		key := msg[start+1 : end]
+		attr, ok := h.findAttr(r, key)
+		if !ok {
+			buf.WriteString(msg[:start+1])
+			msg = msg[start+1:]
+			continue
+		}
+
+		buf.WriteString(msg[:start])
+		buf.WriteStringIf(!h.noColor, h.colors.Value)
+		h.appendValue(buf, attr.Value, false)
+		if !h.noColor && h.colors.Value != "" {
+			buf.WriteString(ansiReset)
+			buf.WriteString(h.colors.Message)
+		}
+		if h.interpolateRemoveAttrs {
+			if s.skip == nil {
+				s.skip = make(map[string]bool)
+			}
+			s.skip[h.groupPrefix+key] = true
+		}
+		msg = msg[end+1:]
+	}
+	buf.WriteString(msg)
+}
+
+// findAttr returns the non-group record attribute with the key relative to the
+// groups of the handler, with ReplaceAttr applied
+func (h *Handler) findAttr(r slog.Record, key string) (attr slog.Attr, ok bool) {
+	var find func(attrs []slog.Attr, prefix string, groups []string) bool
+	find = func(attrs []slog.Attr, prefix string, groups []string) bool {
+		for _, a := range attrs {
+			a.Value = a.Value.Resolve()
+			if a.Value.Kind() == slog.KindGroup {
+				groupPrefix, groups := prefix, groups
+				if a.Key != "" {
+					groupPrefix += a.Key + "."
+					groups = append(groups[:len(groups):len(groups)], a.Key)
+				}
+				if strings.HasPrefix(key, groupPrefix) && find(a.Value.Group(), groupPrefix, groups) {
+					return true
+				}
+				continue
+			}
+			if prefix+a.Key != key {
+				continue
+			}
+			if h.replaceAttr != nil {
+				a = h.replaceAttr(groups, a)
+				a.Value = a.Value.Resolve()
+			}
+			attr, ok = a, a.Key != "" && a.Value.Kind() != slog.KindGroup
+			return true
+		}
+		return false
+	}
+
+	r.Attrs(func(a slog.Attr) bool {
+		return !find([]slog.Attr{a}, "", h.groups)
+	})
+	return attr, ok
+}
+
+// appendMessageHash appends the first 6 hex digits of the FNV-1a hash of the
+// message to the buffer
+func appendMessageHash(buf *buffer, msg string) {
+	const hexDigits = "0123456789abcdef"
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(msg)) // never returns an error
+	sum := hash.Sum32()
+	for shift := 28; shift >= 8; shift -= 4 {
+		buf.WriteChar(hexDigits[sum>>shift&0xf])
+	}
+}
+
+// appendSource appends source details to the buffer
+func (h *Handler) appendSource(buf *buffer, src *slog.Source) {
+	buf.WriteStringIf(!h.noColor, h.colors.Source)
+	buf.WriteString(h.sourcePath(src.File))
+	buf.WriteChar(':')
+	buf.WriteString(strconv.Itoa(src.Line))
+	if h.sourceFunction && src.Function != "" {
+		buf.WriteChar(' ')
+		buf.WriteString(funcName(src.Function))
+	}
+	buf.WriteStringIf(!h.noColor, resetFor(h.colors.Source))
+}
+
+// sourcePath returns the path of a source file relative to
+// Options.SourceBaseDir, or its base name and directory if it's not below it
+func (h *Handler) sourcePath(file string) string {
+	if rel, ok := strings.CutPrefix(filepath.Clean(file), h.sourceBaseDir); ok && h.sourceBaseDir != "" {
+		return rel
+	}
+	dir, file := filepath.Split(file)
+	return filepath.Join(filepath.Base(dir), file)
+}
+
+// funcName returns the name of a function without its package path and name,
+// e.g. "(*Server).handle" for "example.com/app/server.(*Server).handle" or
+// "Handler[...].Get" for the generic method "app.Handler[...].Get"
+func funcName(fn string) string {
+	name := fn[strings.LastIndexByte(fn, '/')+1:]
+	if i := strings.Index(name, ".("); i >= 0 {
+		// pointer receiver, the package name may contain dots, e.g. "yaml.v3"
+		return name[i+1:]
+	}
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// attrState holds the state of appending the attributes of a record or of a
+// call to WithAttrs
+type attrState struct {
+	errs     *buffer // error attributes, if moved by Options.ErrorPosition
+	seen     int     // non-group attributes seen
+	rendered int     // non-group attributes rendered
+
+	skip   map[string]bool // fully-qualified keys of attributes to omit
+	inline int             // depth of groups rendered inline
+
+	// run of attributes with the same group prefix, not yet appended, see
+	// Options.CoalesceGroupPrefix
+	run          []slog.Attr
+	runPrefix    string
+	runKeyPrefix string // runPrefix without hidden groups
+	runBuf       *buffer
+	runStart     int // position of the first attribute of the run, from 1
+
+	// padding of the last attribute appended to padBuf, ending at padEnd, see
+	// Options.ValueColumn
+	pad    int
+	padBuf *buffer
+	padEnd int
+}
+
+// setPad records that the attribute at the end of the buffer was padded with
+// n bytes before its last byte
+func (s *attrState) setPad(buf *buffer, n int) {
+	s.pad, s.padBuf, s.padEnd = n, buf, len(*buf)
+}
+
+// trailingPad returns the number of bytes of padding before the last byte of
+// the last attribute in the buffer, or 0 if anything was appended after it
+func (s *attrState) trailingPad(buf *buffer) int {
+	if s.padBuf != buf || s.padEnd != len(*buf) {
+		return 0
+	}
+	return s.pad
+}
+
+// appendAttr appends an attribute to the buffer
+func (h *Handler) appendAttr(buf *buffer, attr slog.Attr, groupsPrefix string, groups []string, s *attrState) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Value.Kind() != slog.KindGroup {
+		s.seen++
+		if s.skip[groupsPrefix+attr.Key] {
+			return
+		}
+	}
+	if rep := h.replaceAttr; rep != nil && attr.Value.Kind() != slog.KindGroup {
+		attr = rep(groups, attr)
+		attr.Value = attr.Value.Resolve()
+	}
+
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() != slog.KindGroup {
+		s.rendered++
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		if h.maxGroupDepth > 0 && attr.Key != "" && len(groups) >= h.maxGroupDepth {
+			n := countLeaves(attr.Value.Group())
+			s.seen += n
+			s.rendered += n
+			h.flushRun(s)
+			h.appendGroupSummary(buf, attr, h.attrKeyPrefix(groupsPrefix, groups, s), groups)
+			return
+		}
+		if h.groupsAsJSON && attr.Key != "" {
+			n := countLeaves(attr.Value.Group())
+			s.seen += n
+			s.rendered += n
+			h.flushRun(s)
+			h.appendGroupJSON(buf, attr, h.attrKeyPrefix(groupsPrefix, groups, s), groupsPrefix, groups)
+			return
+		}
+		if h.inlineGroups && attr.Key != "" {
+			h.flushRun(s)
+			h.appendInlineGroup(buf, attr, groupsPrefix, groups, s)
+			return
+		}
+		if attr.Key != "" {
+			groupsPrefix += attr.Key + "."
+			groups = append(groups, attr.Key)
+		}
+		for _, groupAttr := range h.sortAttrs(attr.Value.Group()) {
+			h.appendAttr(buf, groupAttr, groupsPrefix, groups, s)
+		}
+	} else if err, ok := attr.Value.Any().(error); ok {
+		h.flushRun(s)
+		if s.errs != nil {
+			buf = s.errs
+		}
+		h.appendErrors(buf, err, attr.Key, h.attrKeyPrefix(groupsPrefix, groups, s))
+	} else if bg, ok := h.flagColor(groups, attr); ok {
+		h.flushRun(s)
+		h.appendFlagged(buf, attr, h.attrKeyPrefix(groupsPrefix, groups, s), groupsPrefix, bg)
+	} else if keyPrefix := h.attrKeyPrefix(groupsPrefix, groups, s); h.coalesceGroupPrefix && keyPrefix != "" {
+		if s.runBuf != buf || s.runPrefix != groupsPrefix {
+			h.flushRun(s)
+			s.runBuf, s.runPrefix, s.runKeyPrefix = buf, groupsPrefix, keyPrefix
+			s.runStart = h.attrsPrefixRendered + s.rendered
+		}
+		s.run = append(s.run, attr)
+	} else {
+		h.flushRun(s)
+		s.setPad(buf, h.appendLeaf(buf, attr, keyPrefix, groupsPrefix, h.dimmed(h.attrsPrefixRendered+s.rendered)))
+	}
+}
+
+// appendInlineGroup appends a non-empty group attribute to the buffer, with its
+// attributes in braces, see Options.InlineGroups
+func (h *Handler) appendInlineGroup(buf *buffer, attr slog.Attr, groupsPrefix string, groups []string, s *attrState) {
+	group := newBuffer()
+	defer group.Free()
+
+	s.inline++
+	for _, groupAttr := range h.sortAttrs(attr.Value.Group()) {
+		h.appendAttr(group, groupAttr, groupsPrefix+attr.Key+".", append(groups, attr.Key), s)
+	}
+	s.inline--
+	if len(*group) == 0 {
+		return
+	}
+
+	h.appendKey(buf, attr.Key, h.attrKeyPrefix(groupsPrefix, groups, s), h.keyColor(attr.Key, groupsPrefix, attr.Value), attr.Value)
+	buf.WriteStringIf(!h.noColor, h.colors.Key)
+	buf.WriteChar('{')
+	buf.WriteStringIf(!h.noColor, resetFor(h.colors.Key))
+	*buf = append(*buf, (*group)[:len(*group)-1]...) // drop the end of the last attribute
+	buf.WriteStringIf(!h.noColor, h.colors.Key)
+	buf.WriteChar('}')
+	buf.WriteStringIf(!h.noColor, resetFor(h.colors.Key))
+	h.appendAttrEnd(buf)
+}
+
+// appendGroupJSON appends a non-empty group attribute to the buffer, with its
+// attributes as a JSON object, see Options.GroupsAsJSON
+func (h *Handler) appendGroupJSON(buf *buffer, attr slog.Attr, keyPrefix, groupsPrefix string, groups []string) {
+	obj, n := h.appendJSONMembers([]byte{'{'}, attr.Value.Group(), append(groups, attr.Key))
+	if n == 0 {
+		return
+	}
+	obj = append(obj, '}')
+
+	h.appendKey(buf, attr.Key, keyPrefix, h.keyColor(attr.Key, groupsPrefix, attr.Value), attr.Value)
+	buf.WriteStringIf(!h.noColor, h.colors.Value)
+	h.appendJSON(buf, json.RawMessage(obj), !h.noQuote)
+	buf.WriteStringIf(!h.noColor && h.colors.Value != "", ansiReset)
+	h.appendAttrEnd(buf)
+}
+
+// appendJSONMembers appends the attributes in the groups to b as members of a
+// JSON object, with the attributes of groups without a key inlined. It returns
+// the extended b and the number of non-group attributes.
+func (h *Handler) appendJSONMembers(b []byte, attrs []slog.Attr, groups []string) ([]byte, int) {
+	var n int
+	for _, attr := range attrs {
+		attr.Value = attr.Value.Resolve()
+		if rep := h.replaceAttr; rep != nil && attr.Value.Kind() != slog.KindGroup {
+			attr = rep(groups, attr)
+			attr.Value = attr.Value.Resolve()
+		}
+		if attr.Equal(slog.Attr{}) {
+			continue
+		}
+
+		isGroup := attr.Value.Kind() == slog.KindGroup
+		if isGroup && attr.Key == "" {
+			var m int
+			b, m = h.appendJSONMembers(b, attr.Value.Group(), groups)
+			n += m
+			continue
+		}
+
+		start := len(b)
+		if b[len(b)-1] != '{' {
+			b = append(b, ',')
+		}
+		key, _ := json.Marshal(attr.Key) // never fails for strings
+		b = append(b, key...)
+		b = append(b, ':')
+		if isGroup {
+			var m int
+			b, m = h.appendJSONMembers(append(b, '{'), attr.Value.Group(), append(groups, attr.Key))
+			if m == 0 {
+				// omit empty groups
+				b = b[:start]
+				continue
+			}
+			b = append(b, '}')
+			n += m
+			continue
+		}
+		b = h.appendJSONValue(b, attr.Value)
+		n++
+	}
+	return b, n
+}
+
+// appendJSONValue appends a non-group value as JSON to b. Values other than
+// strings, finite numbers and booleans are rendered like by appendValue,
+// without colors, as JSON strings.
+func (h *Handler) appendJSONValue(b []byte, v slog.Value) []byte {
+	switch v.Kind() {
+	case slog.KindInt64:
+		return strconv.AppendInt(b, v.Int64(), 10)
+	case slog.KindUint64:
+		return strconv.AppendUint(b, v.Uint64(), 10)
+	case slog.KindBool:
+		return strconv.AppendBool(b, v.Bool())
+	case slog.KindFloat64:
+		if f := v.Float64(); !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return strconv.AppendFloat(b, f, 'g', -1, 64)
+		}
+	case slog.KindString:
+		s, _ := json.Marshal(v.String()) // never fails for strings
+		return append(b, s...)
+	}
+
+	text := newBuffer()
+	defer text.Free()
+	plain := h.plainHandler()
+	plain.hexdumpThreshold = 0
+	plain.prettyStructs = false
+	plain.appendValue(text, v, false)
+	s, _ := json.Marshal(string(*text)) // never fails for strings
+	return append(b, s...)
+}
+
+// attrKeyPrefix returns the prefix of the rendered key of an attribute in the
+// groups, which is empty within groups rendered inline
+func (h *Handler) attrKeyPrefix(groupsPrefix string, groups []string, s *attrState) string {
+	if s.inline > 0 {
+		return ""
+	}
+	return h.keyPrefix(groupsPrefix, groups)
+}
+
+// keyPrefix returns the prefix of rendered keys of attributes in the groups,
+// which is groupsPrefix without the hidden groups, see
+// Options.HidePrefixGroups
+func (h *Handler) keyPrefix(groupsPrefix string, groups []string) string {
+	if len(h.hidePrefixGroups) == 0 {
+		return groupsPrefix
+	}
+	groups = groups[h.headerDepth:] // rendered in the header
+	var prefix string
+	for _, name := range groups {
+		if !h.hidePrefixGroups[name] {
+			prefix += name + "."
+		}
+	}
+	return prefix
+}
+
+// flushRun appends the pending run of attributes with the same group prefix,
+// bracketed if it has more than one attribute
+func (h *Handler) flushRun(s *attrState) {
+	buf := s.runBuf
+	switch len(s.run) {
+	case 0:
+		return
+	case 1:
+		s.setPad(buf, h.appendLeaf(buf, s.run[0], s.runKeyPrefix, s.runPrefix, h.dimmed(s.runStart)))
+	default:
+		buf.WriteStringIf(!h.noColor, h.colors.Key)
+		h.appendString(buf, s.runKeyPrefix, true)
+		buf.WriteChar('{')
+		buf.WriteStringIf(!h.noColor, resetFor(h.colors.Key))
+		var pad int
+		for i, attr := range s.run {
+			pad = h.appendLeaf(buf, attr, "", s.runPrefix, h.dimmed(s.runStart+i))
+		}
+		*buf = (*buf)[:len(*buf)-1-pad] // drop the padding and end of the last attribute
+		buf.WriteStringIf(!h.noColor, h.colors.Key)
+		buf.WriteChar('}')
+		buf.WriteStringIf(!h.noColor, resetFor(h.colors.Key))
+		h.appendAttrEnd(buf)
+	}
+	s.run = s.run[:0]
+	s.runBuf = nil
+}
+
+// appendLeaf appends a non-group, non-error attribute to the buffer, with its
+// key prefixed by keyPrefix, faint if dim is set. The fully-qualified key is
+// groupsPrefix followed by the key. It returns the number of bytes of padding
+// before the last byte ending the attribute, which are dropped if the attribute
+// ends the line.
+func (h *Handler) appendLeaf(buf *buffer, attr slog.Attr, keyPrefix, groupsPrefix string, dim bool) (pad int) {
+	if h.diffKeys[groupsPrefix+attr.Key] && h.appendDiff(buf, groupsPrefix+attr.Key, keyPrefix+attr.Key, attr.Value.Any()) {
+		return 0
+	}
+	keyColor, valueColor := h.keyColor(attr.Key, groupsPrefix, attr.Value), h.colors.Value
+	if dim {
+		keyColor, valueColor = h.colors.Faint, h.colors.Faint
+	}
+	h.appendKey(buf, attr.Key, keyPrefix, keyColor, attr.Value)
+	start := len(*buf)
+	buf.WriteStringIf(!h.noColor, valueColor)
+	var hexdump bool
+	switch format := h.syntaxHighlight[groupsPrefix+attr.Key]; {
+	case format != "" && !h.noColor && h.appendHighlighted(buf, attr.Value, format):
+	case len(h.intEnums) > 0 && h.appendIntEnum(buf, groupsPrefix+attr.Key, attr.Value):
+	case h.badgeKeys[groupsPrefix+attr.Key] && attr.Value.Kind() == slog.KindBool:
+		h.appendBadge(buf, attr.Value.Bool())
+	case h.goSyntaxKeys[groupsPrefix+attr.Key] && attr.Value.Kind() == slog.KindAny:
+		h.appendValueString(buf, fmt.Sprintf("%#v", attr.Value.Any()), !h.noQuote)
+	default:
+		h.appendValue(buf, attr.Value, true)
+		hexdump = h.isHexdump(attr.Value)
+	}
+	buf.WriteStringIf(!h.noColor && valueColor != "", ansiReset)
+	if width, ok := h.rightAlign[groupsPrefix+attr.Key]; ok && isNumber(attr.Value) {
+		if pad := width - visibleWidth((*buf)[start:]); pad > 0 {
+			*buf = slices.Insert(*buf, start, bytes.Repeat([]byte{' '}, pad)...)
+		}
+	}
+	if h.showRate[groupsPrefix+attr.Key] {
+		h.appendRate(buf, groupsPrefix+attr.Key, attr.Value)
+	}
+	if width := max(h.valueColumn, h.valuePad[groupsPrefix+attr.Key]); width > 0 {
+		pad = max(width-visibleWidth((*buf)[start:]), 0)
+		appendPadding(buf, pad)
+	}
+	if hexdump && !h.cardMode {
+		// continue with the next attribute on a new line, not after the dump
+		buf.WriteChar('\n')
+		if h.indent == "" {
+			return pad
+		}
+		buf.WriteString(h.indent)
+		return pad + len(h.indent)
+	}
+	h.appendAttrEnd(buf)
+	return pad
+}
+
+// isHexdump returns true if the value is rendered as a hexdump, see
+// Options.HexdumpBytes
+func (h *Handler) isHexdump(v slog.Value) bool {
+	if h.hexdumpThreshold == 0 || v.Kind() != slog.KindAny {
+		return false
+	}
+	b, ok := v.Any().([]byte)
+	return ok && len(b) > h.hexdumpThreshold
+}
+
+// isNumber returns true if the value is an integer or a float
+func isNumber(v slog.Value) bool {
+	switch v.Kind() {
+	case slog.KindInt64, slog.KindUint64, slog.KindFloat64:
+		return true
+	default:
+		return false
+	}
+}
+
+// dimmed returns true if the attribute at the position, from 1, is rendered
+// faint, see Options.DimTailAttrs
+func (h *Handler) dimmed(pos int) bool {
+	return h.dimTail > 0 && pos > h.dimTail
+}
+
+// appendBadge appends a boolean value as a badge to the buffer, e.g. "[ ON]"
+func (h *Handler) appendBadge(buf *buffer, on bool) {
+	text, color := "OFF", h.colors.Error
+	if on {
+		text, color = "ON", h.colors.Info
+	}
+	buf.WriteChar('[')
+	buf.WriteStringIf(!h.noColor, color)
+	appendPadding(buf, h.badgeWidth-utf8.RuneCountInString(text))
+	buf.WriteString(text)
+	buf.WriteStringIf(!h.noColor, ansiReset)
+	buf.WriteChar(']')
+}
+
+// flagColor returns the background color of a flagged attribute, see
+// Options.FlagAttr
+func (h *Handler) flagColor(groups []string, attr slog.Attr) (string, bool) {
+	if h.flagAttr == nil || h.noColor {
+		return "", false
+	}
+	return h.flagAttr(groups, attr)
+}
+
+// appendFlagged appends a non-group, non-error attribute to the buffer like
+// appendLeaf, with the key=value pair on the background color bg. The
+// background is restored after each reset within the pair.
+func (h *Handler) appendFlagged(buf *buffer, attr slog.Attr, keyPrefix, groupsPrefix, bg string) {
+	buf.WriteString(bg)
+	start := len(*buf)
+	h.appendLeaf(buf, attr, keyPrefix, groupsPrefix, false)
+
+	end := (*buf)[len(*buf)-1]
+	pair := bytes.ReplaceAll((*buf)[start:len(*buf)-1], []byte(ansiReset), []byte(ansiReset+bg))
+	*buf = append((*buf)[:start], bytes.TrimSuffix(pair, []byte(bg))...)
+	if !bytes.HasSuffix(*buf, []byte(ansiReset)) {
+		buf.WriteString(ansiReset)
+	}
+	buf.WriteChar(end)
+}
+
+// appendAttrEnd ends an attribute with a space, or with a newline in card mode
+func (h *Handler) appendAttrEnd(buf *buffer) {
+	if h.cardMode {
+		buf.WriteChar('\n')
+	} else {
+		buf.WriteChar(' ')
+	}
+}
+
+// appendRate appends the per-second rate of change of a numeric value since the
+// previously logged value of the key to the buffer, e.g. " (+50/s)"
+func (h *Handler) appendRate(buf *buffer, key string, v slog.Value) {
+	var f float64
+	switch v.Kind() {
+	case slog.KindInt64:
+		f = float64(v.Int64())
+	case slog.KindUint64:
+		f = float64(v.Uint64())
+	case slog.KindFloat64:
+		f = v.Float64()
+	default:
+		return
+	}
+	now := h.now()
+
+	h.state.mu.Lock()
+	prev, ok := h.state.rates[key]
+	if h.state.rates == nil {
+		h.state.rates = make(map[string]rateSample)
+	}
+	h.state.rates[key] = rateSample{t: now, v: f}
+	h.state.mu.Unlock()
+
+	elapsed := now.Sub(prev.t).Seconds()
+	if !ok || elapsed <= 0 {
+		return
+	}
+
+	rate := math.Round((f-prev.v)/elapsed*100) / 100
+	buf.WriteStringIf(!h.noColor, h.colors.Faint)
+	buf.WriteString(" (")
+	if rate >= 0 {
+		buf.WriteChar('+')
+	}
+	*buf = strconv.AppendFloat(*buf, rate, 'f', -1, 64)
+	buf.WriteString("/s)")
+	buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+}
+
+// appendGroupSummary appends a group as its key and the number of fields it
+// contains, e.g. "deep.group{…5 fields}"
+func (h *Handler) appendGroupSummary(buf *buffer, attr slog.Attr, groupsPrefix string, groups []string) {
+	n := h.countRendered(attr.Value.Group(), append(groups, attr.Key))
+	if n == 0 {
+		return
+	}
+
+	buf.WriteStringIf(!h.noColor, h.colors.Faint)
+	h.appendString(buf, groupsPrefix+attr.Key, true)
+	buf.WriteString("{…")
+	*buf = strconv.AppendInt(*buf, int64(n), 10)
+	if n == 1 {
+		buf.WriteString(" field}")
+	} else {
+		buf.WriteString(" fields}")
+	}
+	buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+	h.appendAttrEnd(buf)
+}
+
+// countRendered returns the number of non-group attributes in the groups that
+// are not dropped by Options.ReplaceAttr
+func (h *Handler) countRendered(attrs []slog.Attr, groups []string) int {
+	n := 0
+	for _, attr := range attrs {
+		attr.Value = attr.Value.Resolve()
+		if attr.Value.Kind() == slog.KindGroup {
+			if attr.Key != "" {
+				n += h.countRendered(attr.Value.Group(), append(groups, attr.Key))
+			} else {
+				n += h.countRendered(attr.Value.Group(), groups)
+			}
+			continue
+		}
+		if h.replaceAttr != nil {
+			attr = h.replaceAttr(groups, attr)
+		}
+		if !attr.Equal(slog.Attr{}) {
+			n++
+		}
+	}
+	return n
+}
+
+// numAttrs returns the number of non-group handler and record attributes
+func (h *Handler) numAttrs(r slog.Record) int {
+	n := h.attrsPrefixSeen
+	r.Attrs(func(attr slog.Attr) bool {
+		n += countLeaves([]slog.Attr{attr})
+		return true
+	})
+	return n
+}
+
+// countLeaves returns the number of non-group attributes in attrs, including
+// those of nested groups
+func countLeaves(attrs []slog.Attr) int {
+	n := 0
+	for _, attr := range attrs {
+		attr.Value = attr.Value.Resolve()
+		if attr.Equal(slog.Attr{}) {
+			continue
+		}
+		if attr.Value.Kind() == slog.KindGroup {
+			n += countLeaves(attr.Value.Group())
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// keyColor returns the color of the key for the given value
+func (h *Handler) keyColor(key, groups string, v slog.Value) string {
+	if len(h.keyPalette) > 0 {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(groups + key)) // never returns an error
+		return h.keyPalette[hash.Sum32()%uint32(len(h.keyPalette))]
+	}
+	if color, ok := h.kindKeyColors[v.Kind()]; ok {
+		return color
+	}
+	return h.colors.Key
+}
+
+// appendKey appends the key of a value to the buffer
+func (h *Handler) appendKey(buf *buffer, key, groups, color string, v slog.Value) {
+	buf.WriteStringIf(!h.noColor, color)
+	start := len(*buf)
+	h.appendString(buf, groups+key, true)
+	if h.annotateKeyTypes {
+		buf.WriteStringIf(!h.noColor, resetFor(color))
+		buf.WriteStringIf(!h.noColor, h.colors.Faint)
+		buf.WriteChar('<')
+		buf.WriteString(valueType(v))
+		buf.WriteChar('>')
+		buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+		buf.WriteStringIf(!h.noColor, color)
+	}
+	if pad := h.keyWidth - visibleWidth((*buf)[start:]); pad > 0 {
+		// pad outside of the color
+		buf.WriteStringIf(!h.noColor, resetFor(color))
+		appendPadding(buf, pad)
+		buf.WriteStringIf(!h.noColor, color)
+	}
+	buf.WriteString(h.kvSep)
+	buf.WriteStringIf(!h.noColor, resetFor(color))
+}
+
+// valueType returns the lowercase kind of a value, e.g. "int64", or the Go type
+// of slog.KindAny values, e.g. "*url.URL"
+func valueType(v slog.Value) string {
+	if v.Kind() == slog.KindAny {
+		return fmt.Sprintf("%T", v.Any())
+	}
+	return strings.ToLower(v.Kind().String())
+}
+
+// appendValue appends a value to the buffer. slog.KindAny values are rendered
+// by the first of the following that applies:
+//   - slog.Level, net and net/netip addresses and prefixes
+//   - encoding.TextMarshaler
+//   - *slog.Source and *url.URL
+//   - fmt.Stringer, unless it's a json.Marshaler and Options.MarshalJSON is set
+//   - []byte, see Options.HexdumpBytes
+//   - Options.PrettyStructs, Options.GoSyntaxValues and Options.MarshalJSON
+//   - fmt's "%+v"
+func (h *Handler) appendValue(buf *buffer, v slog.Value, quote bool) {
+	quote = quote && !h.noQuote
+	switch v.Kind() {
+	case slog.KindString:
+		h.appendValueString(buf, v.String(), quote)
+	case slog.KindInt64:
+		if h.digitSeparator != "" {
+			var scratch [20]byte
+			appendDigitGroups(buf, strconv.AppendInt(scratch[:0], v.Int64(), 10), h.digitSeparator)
+		} else {
+			*buf = strconv.AppendInt(*buf, v.Int64(), 10)
+		}
+	case slog.KindUint64:
+		if h.digitSeparator != "" {
+			var scratch [20]byte
+			appendDigitGroups(buf, strconv.AppendUint(scratch[:0], v.Uint64(), 10), h.digitSeparator)
+		} else {
+			*buf = strconv.AppendUint(*buf, v.Uint64(), 10)
+		}
+	case slog.KindFloat64:
+		*buf = strconv.AppendFloat(*buf, v.Float64(), 'g', -1, 64)
+	case slog.KindBool:
+		*buf = strconv.AppendBool(*buf, v.Bool())
+	case slog.KindDuration:
+		h.appendValueString(buf, v.Duration().String(), quote)
+	case slog.KindTime:
+		if v.Time().IsZero() && h.zeroTimeText != "" {
+			h.appendValueString(buf, h.zeroTimeText, quote)
+			break
+		}
+		t := v.Time()
+		if h.timeLocation != nil {
+			t = t.In(h.timeLocation)
+		}
+		h.appendValueString(buf, t.String(), quote)
 	case slog.KindAny:
 		switch cv := v.Any().(type) {
 		case slog.Level:
-			h.appendLevel(buf, cv)
+			h.appendLevel(buf, h.renderedLevel(cv))
+		case net.IP:
+			h.appendValueString(buf, cv.String(), quote)
+		case *net.IPNet:
+			h.appendValueString(buf, cv.String(), quote)
+		case net.IPNet:
+			h.appendValueString(buf, cv.String(), quote)
+		case netip.Addr:
+			h.appendValueString(buf, cv.String(), quote)
+		case netip.Prefix:
+			h.appendValueString(buf, cv.String(), quote)
 		case encoding.TextMarshaler:
 			data, err := cv.MarshalText()
 			if err != nil {
 				break
 			}
-			appendString(buf, string(data), quote)
+			h.appendValueString(buf, string(data), quote)
 		case *slog.Source:
 			h.appendSource(buf, cv)
+		case *url.URL:
+			if cv == nil {
+				buf.WriteString("<nil>")
+				break
+			}
+			h.appendValueString(buf, cv.String(), quote)
+		case fmt.Stringer:
+			if _, ok := cv.(json.Marshaler); ok && h.marshalJSON && h.appendJSON(buf, cv, quote) {
+				break
+			}
+			if rv := reflect.ValueOf(cv); rv.Kind() == reflect.Pointer && rv.IsNil() {
+				buf.WriteString("<nil>")
+				break
+			}
+			h.appendValueString(buf, cv.String(), quote)
+		case []byte:
+			if h.hexdumpThreshold > 0 && len(cv) > h.hexdumpThreshold {
+				h.appendHexdump(buf, cv)
+				break
+			}
+			h.appendBytes(buf, cv, quote)
 		default:
-			appendString(buf, fmt.Sprintf("%+v", v.Any()), quote)
+			if h.prettyStructs && isPretty(cv) {
+				h.appendPretty(buf, reflect.ValueOf(cv), 0, make(map[uintptr]bool))
+				break
+			}
+			if h.goSyntax {
+				h.appendValueString(buf, fmt.Sprintf("%#v", cv), quote)
+				break
+			}
+			if h.marshalJSON && h.appendJSON(buf, cv, quote) {
+				break
+			}
+			h.appendValueString(buf, fmt.Sprintf("%+v", v.Any()), quote)
 		}
 	}
 }
 
-// appendError appends an error to the buffer
-func (h *handler) appendError(buf *buffer, err error, attrKey, groupsPrefix string) {
-	buf.WriteStringIf(!h.noColor, ansiBrightRedFaint)
-	appendString(buf, groupsPrefix+attrKey, true)
-	buf.WriteChar('=')
-	buf.WriteStringIf(!h.noColor, ansiResetFaint)
-	appendString(buf, err.Error(), true)
-	buf.WriteStringIf(!h.noColor, ansiReset)
+// appendJSON appends the JSON encoding of a value to the buffer, quoted only if
+// it contains spaces or the key-value separator. It returns false if the value
+// can't be encoded.
+func (h *Handler) appendJSON(buf *buffer, v any, quote bool) bool {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	s := string(data)
+	quote = quote && (strings.ContainsFunc(s, unicode.IsSpace) || strings.Contains(s, h.kvSep))
+	h.appendValueString(buf, s, quote)
+	return true
+}
+
+// appendIntEnum appends the name of an integer value from Options.IntEnums to
+// the buffer. It returns false if the value has no name.
+func (h *Handler) appendIntEnum(buf *buffer, key string, v slog.Value) bool {
+	var n int64
+	switch v.Kind() {
+	case slog.KindInt64:
+		n = v.Int64()
+	case slog.KindUint64:
+		if v.Uint64() > math.MaxInt64 {
+			return false
+		}
+		n = int64(v.Uint64())
+	default:
+		return false
+	}
+
+	name, ok := h.intEnums[key][n]
+	if !ok {
+		return false
+	}
+	if !h.intEnumNameOnly {
+		name += "(" + strconv.FormatInt(n, 10) + ")"
+	}
+	h.appendValueString(buf, name, true)
+	return true
+}
+
+// appendDigitGroups appends a decimal number to the buffer, separating groups
+// of three digits with sep
+func appendDigitGroups(buf *buffer, num []byte, sep string) {
+	if len(num) > 0 && num[0] == '-' {
+		buf.WriteChar('-')
+		num = num[1:]
+	}
+	for i, digit := range num {
+		if i > 0 && (len(num)-i)%3 == 0 {
+			buf.WriteString(sep)
+		}
+		buf.WriteChar(digit)
+	}
+}
+
+// appendErrors appends an error followed by a space to the buffer. If
+// Options.ExpandJoinedErrors is set, joined errors are appended one by one,
+// with their index added to the key, e.g. "err[0]=... err[1]=...". If
+// Options.ExpandErrors is set, each layer of a wrapped error is appended with
+// the key "cause", e.g. "err=outer cause=inner"
+func (h *Handler) appendErrors(buf *buffer, err error, attrKey, groupsPrefix string) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok && h.expandJoinedErrors {
+		for i, err := range joined.Unwrap() {
+			h.appendErrors(buf, err, attrKey+"["+strconv.Itoa(i)+"]", groupsPrefix)
+		}
+		return
+	}
+
+	if !h.expandErrors {
+		h.appendError(buf, err.Error(), attrKey, groupsPrefix)
+		if h.errorStackTrace {
+			h.appendStackTrace(buf, chainStackTrace(err))
+		}
+		h.appendAttrEnd(buf)
+		return
+	}
+
+	for err != nil {
+		msg := err.Error()
+		next := errors.Unwrap(err)
+		if next != nil {
+			if msg == next.Error() {
+				// the layer only forwards the message of its cause
+				err = next
+				continue
+			}
+			msg = strings.TrimSuffix(msg, ": "+next.Error())
+		}
+		h.appendError(buf, msg, attrKey, groupsPrefix)
+		if h.errorStackTrace {
+			h.appendStackTrace(buf, stackTrace(err))
+		}
+		h.appendAttrEnd(buf)
+		attrKey = "cause"
+		err = next
+	}
+}
+
+// appendError appends an error message to the buffer
+func (h *Handler) appendError(buf *buffer, msg, attrKey, groupsPrefix string) {
+	buf.WriteStringIf(!h.noErrorColor, h.colors.ErrorKey)
+	h.appendString(buf, groupsPrefix+attrKey, true)
+	buf.WriteString(h.kvSep)
+	buf.WriteStringIf(!h.noErrorColor, h.colors.ErrorValue)
+	h.appendString(buf, msg, true)
+	buf.WriteStringIf(!h.noErrorColor, ansiReset)
+}
+
+// appendStackTrace appends the frames of a stack trace to the buffer, each on
+// a line preceded by a newline and the indentation
+func (h *Handler) appendStackTrace(buf *buffer, pcs []uintptr) {
+	if len(pcs) == 0 {
+		return
+	}
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		buf.WriteChar('\n')
+		buf.WriteString(h.indent)
+		buf.WriteStringIf(!h.noColor, h.colors.Faint)
+		buf.WriteString(h.sourcePath(f.File))
+		buf.WriteChar(':')
+		buf.WriteString(strconv.Itoa(f.Line))
+		if f.Function != "" {
+			buf.WriteChar(' ')
+			buf.WriteString(funcName(f.Function))
+		}
+		buf.WriteStringIf(!h.noColor, resetFor(h.colors.Faint))
+		if !more {
+			return
+		}
+	}
+}
+
+// chainStackTrace returns the stack trace of the innermost error in the chain
+// of err that carries one, which is the closest to where the error occurred
+func chainStackTrace(err error) []uintptr {
+	var pcs []uintptr
+	for ; err != nil; err = errors.Unwrap(err) {
+		if p := stackTrace(err); p != nil {
+			pcs = p
+		}
+	}
+	return pcs
+}
+
+// stackTrace returns the program counters of the stack trace carried by err,
+// if err has a StackTrace method returning a slice of them. The method is
+// looked up by reflection to support types like errors.StackTrace of
+// github.com/pkg/errors without depending on them.
+func stackTrace(err error) []uintptr {
+	if st, ok := err.(interface{ StackTrace() []uintptr }); ok {
+		return st.StackTrace()
+	}
+	m := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return nil
+	}
+	if t := m.Type().Out(0); t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+	v := m.Call(nil)[0]
+	pcs := make([]uintptr, v.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(v.Index(i).Uint())
+	}
+	return pcs
+}
+
+// appendBytes appends bytes to the buffer, encoded as set by
+// Options.BytesFormat
+func (h *Handler) appendBytes(buf *buffer, b []byte, quote bool) {
+	switch h.bytesFormat {
+	case BytesFormatHex:
+		h.appendValueString(buf, hex.EncodeToString(b), quote)
+	case BytesFormatBase64:
+		h.appendValueString(buf, base64.StdEncoding.EncodeToString(b), quote)
+	case BytesFormatQuoted:
+		buf.WriteString(strconv.Quote(string(b)))
+	case BytesFormatRaw:
+		h.appendValueString(buf, string(b), quote)
+	default:
+		h.appendValueString(buf, fmt.Sprintf("%+v", b), quote)
+	}
+}
+
+// appendHexdump appends a hexdump of b to the buffer, each line preceded by a
+// newline and the indentation
+func (h *Handler) appendHexdump(buf *buffer, b []byte) {
+	dump := hex.Dump(b)
+	for _, line := range strings.Split(strings.TrimSuffix(dump, "\n"), "\n") {
+		buf.WriteChar('\n')
+		buf.WriteString(h.indent)
+		buf.WriteString(line)
+	}
+}
+
+// appendValueString appends a string value to the buffer. If quoted values are
+// highlighted, the quotes are rendered in faint.
+func (h *Handler) appendValueString(buf *buffer, s string, quote bool) {
+	if !h.highlightQuoted || h.noColor || !quote || !needsQuoting(s, h.kvSep) {
+		h.appendString(buf, s, quote)
+		return
+	}
+
+	quoted := strconv.Quote(s)
+	buf.WriteString(h.colors.Faint)
+	buf.WriteChar('"')
+	buf.WriteString(resetFor(h.colors.Faint))
+	buf.WriteString(h.colors.Value)
+	buf.WriteString(quoted[1 : len(quoted)-1])
+	buf.WriteString(h.colors.Faint)
+	buf.WriteChar('"')
+	buf.WriteString(resetFor(h.colors.Faint))
+	buf.WriteString(h.colors.Value)
+}
+
+// resetFor returns the escape sequence ending the color. Faint is ended
+// without resetting other attributes, preserving any surrounding color.
+func resetFor(color string) string {
+	if color == ansiFaint {
+		return ansiResetFaint
+	}
+	return ansiReset
 }
 
-// appendString appends a string to the buffer
+// appendString appends a string to the buffer, quoted if it needs quoting in
+// key=value pairs
 func appendString(buf *buffer, s string, quote bool) {
-	if quote && needsQuoting(s) {
+	if quote && needsQuoting(s, defaultKeyValueSeparator) {
 		*buf = strconv.AppendQuote(*buf, s)
 	} else {
 		buf.WriteString(s)
 	}
 }
 
-// needsQuoting returns true if the string needs quoting
-func needsQuoting(s string) bool {
-	if len(s) == 0 {
+// appendString appends a string to the buffer, quoted if it needs quoting with
+// the key-value separator of the handler
+func (h *Handler) appendString(buf *buffer, s string, quote bool) {
+	if quote && needsQuoting(s, h.kvSep) {
+		*buf = strconv.AppendQuote(*buf, s)
+	} else {
+		buf.WriteString(s)
+	}
+}
+
+// appendPadding appends n spaces to the buffer
+func appendPadding(buf *buffer, n int) {
+	for ; n > 0; n-- {
+		buf.WriteChar(' ')
+	}
+}
+
+// visibleWidth returns the number of runes in b, ignoring ANSI escape sequences
+func visibleWidth(b []byte) int {
+	n := 0
+	for i := 0; i < len(b); i++ {
+		if b[i] == '\033' && i+1 < len(b) && b[i+1] == '[' {
+			// skip to the final byte of the escape sequence
+			for i += 2; i < len(b) && (b[i] < 0x40 || b[i] > 0x7e); i++ {
+			}
+			continue
+		}
+		if utf8.RuneStart(b[i]) {
+			n++
+		}
+	}
+	return n
+}
+
+// needsQuoting returns true if the string needs quoting in pairs separated by
+// the key-value separator sep
+func needsQuoting(s, sep string) bool {
+	if len(s) == 0 || strings.Contains(s, sep) {
 		return true
 	}
 	for _, r := range s {
-		if unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r) {
+		if unicode.IsSpace(r) || r == '"' || !unicode.IsPrint(r) {
 			return true
 		}
 	}
@@ -3,13 +3,22 @@ package tinter
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"math"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -360,100 +369,2688 @@ func TestHandler(t *testing.T) {
 			},
 			Want: `Nov 10 23:00:00.000 ERR test error=fail`,
 		},
+		{
+			Opts: &Options{
+				Level:      slog.LevelDebug - 4,
+				LevelStyle: LevelStyleStatusTags,
+			},
+			F: func(l *slog.Logger) {
+				l.Log(context.TODO(), slog.LevelDebug-4, "test")
+				l.Debug("test")
+				l.Info("test")
+				l.Warn("test")
+				l.Error("test")
+				l.Log(context.TODO(), slog.LevelError+2, "test")
+			},
+			Want: "Nov 10 23:00:00.000 · test\n" +
+				"Nov 10 23:00:00.000 · test\n" +
+				"Nov 10 23:00:00.000 • test\n" +
+				"Nov 10 23:00:00.000 ! test\n" +
+				"Nov 10 23:00:00.000 ✗ test\n" +
+				"Nov 10 23:00:00.000 ✗ test",
+		},
+		{
+			Opts: &Options{
+				Columns: []Column{
+					{Key: "method", Width: 11},
+					{Key: "http.status", Width: 15},
+					{Key: "path", Width: 11},
+				},
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "path", "/users", "method", "GET", "extra", 1, slog.Group("http", "status", 200))
+				l.Info("test", "method", "POST", "path", "/login")
+				l.Info("test", "extra", 2)
+			},
+			Want: "Nov 10 23:00:00.000 INF test method=GET  http.status=200 path=/users extra=1\n" +
+				"Nov 10 23:00:00.000 INF test method=POST                 path=/login\n" +
+				"Nov 10 23:00:00.000 INF test " + strings.Repeat(" ", 11+1+15+1+11+1) + "extra=2",
+		},
+		{
+			Opts: &Options{
+				TimeAtEnd: true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "key", "val")
+			},
+			Want: `INF test key=val Nov 10 23:00:00.000`,
+		},
+		{
+			Opts: &Options{
+				TimeAtEnd:   true,
+				ReplaceAttr: replace(slog.IntValue(42), slog.TimeKey),
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test")
+			},
+			Want: `INF test 42`,
+		},
+		{
+			Opts: &Options{
+				MaxGroupDepth: 2,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", slog.Group("a", "k", 1, slog.Group("b", "k", 2)))
+				l.Info("test", slog.Group("a", slog.Group("b", "k", 1, slog.Group("c", "x", 1, slog.Group("d", "y", 2, "z", 3)))))
+				l.WithGroup("a").Info("test", slog.Group("b", slog.Group("c", "x", 1)))
+			},
+			Want: "Nov 10 23:00:00.000 INF test a.k=1 a.b.k=2\n" +
+				"Nov 10 23:00:00.000 INF test a.b.k=1 a.b.c{…3 fields}\n" +
+				"Nov 10 23:00:00.000 INF test a.b.c{…1 field}",
+		},
+		{
+			Opts: &Options{
+				MaxGroupDepth: 1,
+			},
+			F: func(l *slog.Logger) {
+				l.WithGroup("h").Info("test", "k", 1, slog.Group("g", "x", 1))
+				l.WithGroup("h").With(slog.Group("g", "x", 1, "y", 2)).Info("test")
+			},
+			Want: "Nov 10 23:00:00.000 INF test h.k=1 h.g{…1 field}\n" +
+				"Nov 10 23:00:00.000 INF test h.g{…2 fields}",
+		},
+		{
+			Opts: &Options{
+				GroupDigits: true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "a", 1234567, "b", -1234567, "c", 123, "d", -100, "e", uint64(18446744073709551615))
+			},
+			Want: `Nov 10 23:00:00.000 INF test a=1,234,567 b=-1,234,567 c=123 d=-100 e=18,446,744,073,709,551,615`,
+		},
+		{
+			Opts: &Options{
+				GroupDigits:    true,
+				DigitSeparator: "_",
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "a", 1000)
+			},
+			Want: `Nov 10 23:00:00.000 INF test a=1_000`,
+		},
+		{
+			Opts: &Options{
+				IntEnums: map[string]map[int64]string{
+					"state":     {0: "idle", 1: "running"},
+					"conn.code": {3: "closed"},
+				},
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "state", 1, "other", 1, "state", 7)
+				l.WithGroup("conn").Info("test", "code", uint64(3), "state", 0)
+			},
+			Want: "Nov 10 23:00:00.000 INF test state=running(1) other=1 state=7\n" +
+				"Nov 10 23:00:00.000 INF test conn.code=closed(3) conn.state=0",
+		},
+		{
+			Opts: &Options{
+				IntEnums:        map[string]map[int64]string{"state": {0: "idle"}},
+				IntEnumNameOnly: true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "state", 0, "state", "0")
+			},
+			Want: `Nov 10 23:00:00.000 INF test state=idle state=0`,
+		},
+		{
+			Opts: &Options{
+				GroupPrefixHeader: true,
+			},
+			F: func(l *slog.Logger) {
+				l.With("a", 1).WithGroup("http").With("b", 2).Info("test", "method", "GET", slog.Group("req", "id", 1))
+				l.WithGroup("http").With("b", 2).Info("test", "method", "GET", slog.Group("req", "id", 1))
+				l.WithGroup("http").With("b", 2).WithGroup("server").Info("test", "port", 80)
+				l.WithGroup("http").WithGroup("server").Info("test", "port", 80)
+				l.Info("test", slog.Group("http", "method", "GET"))
+			},
+			Want: "Nov 10 23:00:00.000 INF test a=1 http.b=2 http.method=GET http.req.id=1\n" +
+				"Nov 10 23:00:00.000 INF [http] test b=2 method=GET req.id=1\n" +
+				"Nov 10 23:00:00.000 INF [http] test b=2 server.port=80\n" +
+				"Nov 10 23:00:00.000 INF [http.server] test port=80\n" +
+				"Nov 10 23:00:00.000 INF test http.method=GET",
+		},
+		{
+			Opts: &Options{
+				ValueColumn: 6,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "a", "x", "long", "abcdefgh", "b", 1)
+			},
+			Want: `Nov 10 23:00:00.000 INF test a=x      long=abcdefgh b=1`,
+		},
+		{
+			Opts: &Options{
+				ValueColumn:         6,
+				NoQuote:             true,
+				CoalesceGroupPrefix: true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "k", "ab  ")
+				l.With("a", "x").Info("test")
+				l.With("a", "x").Info("test", "err", errTest)
+				l.Info("test", slog.Group("g", "a", 1, "b", 2))
+			},
+			Want: "Nov 10 23:00:00.000 INF test k=ab  \n" +
+				"Nov 10 23:00:00.000 INF test a=x\n" +
+				"Nov 10 23:00:00.000 INF test a=x      err=fail\n" +
+				"Nov 10 23:00:00.000 INF test g.{a=1      b=2}",
+		},
+		{
+			Opts: &Options{
+				Level:          slog.LevelDebug - 4,
+				LnavCompatible: true,
+				TimeAtEnd:      true,
+			},
+			F: func(l *slog.Logger) {
+				l.Log(context.TODO(), slog.LevelDebug-4, "test")
+				l.Debug("test", "key", "val")
+				l.Info("test", "key", "val")
+				l.Log(context.TODO(), slog.LevelInfo+1, "test")
+				l.Warn("test")
+				l.Error("test", "err", errTest)
+			},
+			Want: "2009-11-10T23:00:00.000Z TRACE test\n" +
+				"2009-11-10T23:00:00.000Z DEBUG test key=val\n" +
+				"2009-11-10T23:00:00.000Z INFO  test key=val\n" +
+				"2009-11-10T23:00:00.000Z INFO+1 test\n" +
+				"2009-11-10T23:00:00.000Z WARN  test\n" +
+				"2009-11-10T23:00:00.000Z ERROR test err=fail",
+		},
+		{
+			Opts: &Options{
+				ExpandJoinedErrors: true,
+			},
+			F: func(l *slog.Logger) {
+				l.Error("test", "err", errors.Join(errors.New("a"), errors.New("b b"), errors.New("c")), "key", "val")
+				l.Error("test", slog.Group("group", "err", errors.Join(errTest, errors.Join(errTest, errTest))))
+			},
+			Want: "Nov 10 23:00:00.000 ERR test err[0]=a err[1]=\"b b\" err[2]=c key=val\n" +
+				"Nov 10 23:00:00.000 ERR test group.err[0]=fail group.err[1][0]=fail group.err[1][1]=fail",
+		},
+		{
+			F: func(l *slog.Logger) {
+				l.Error("test", "err", errors.Join(errors.New("a"), errors.New("b")))
+			},
+			Want: `Nov 10 23:00:00.000 ERR test err="a\nb"`,
+		},
+		{
+			Opts: &Options{
+				ErrorPosition: ErrorsFirst,
+			},
+			F: func(l *slog.Logger) {
+				l.With("a", 1, "err1", errTest).Error("test", "b", 2, "err2", errTest, slog.Group("g", "err3", errTest, "c", 3))
+			},
+			Want: `Nov 10 23:00:00.000 ERR test err1=fail err2=fail g.err3=fail a=1 b=2 g.c=3`,
+		},
+		{
+			Opts: &Options{
+				ErrorPosition: ErrorsLast,
+			},
+			F: func(l *slog.Logger) {
+				l.With("a", 1, "err1", errTest).Error("test", "b", 2, "err2", errTest, slog.Group("g", "err3", errTest, "c", 3))
+			},
+			Want: `Nov 10 23:00:00.000 ERR test a=1 b=2 g.c=3 err1=fail err2=fail g.err3=fail`,
+		},
+		{
+			Opts: &Options{
+				ErrorPosition: ErrorsInline,
+			},
+			F: func(l *slog.Logger) {
+				l.With("a", 1, "err1", errTest).Error("test", "b", 2, "err2", errTest, slog.Group("g", "err3", errTest, "c", 3))
+			},
+			Want: `Nov 10 23:00:00.000 ERR test a=1 err1=fail b=2 err2=fail g.err3=fail g.c=3`,
+		},
+		{
+			F: func(l *slog.Logger) {
+				u, _ := url.Parse("https://user@example.com:8080/path?q=a b#frag")
+				l.Info("test", "url", u, "nil", (*url.URL)(nil))
+			},
+			Want: `Nov 10 23:00:00.000 INF test url="https://user@example.com:8080/path?q=a b#frag" nil=<nil>`,
+		},
+		{
+			F: func(l *slog.Logger) {
+				_, ipNet, _ := net.ParseCIDR("10.0.0.0/8")
+				l.Info("test",
+					"ip", net.ParseIP("192.168.1.1"),
+					"ip6", net.ParseIP("2001:db8::1"),
+					"ipnet", ipNet,
+					"ipnetval", *ipNet,
+					"addr", netip.MustParseAddr("192.168.1.1"),
+					"prefix", netip.MustParsePrefix("192.168.0.0/16"),
+					"nil", net.IP(nil),
+				)
+			},
+			Want: `Nov 10 23:00:00.000 INF test ip=192.168.1.1 ip6=2001:db8::1 ipnet=10.0.0.0/8 ipnetval=10.0.0.0/8 addr=192.168.1.1 prefix=192.168.0.0/16 nil=<nil>`,
+		},
+		{
+			Opts: &Options{
+				ValuePad: map[string]int{"status": 4, "g.status": 6},
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "status", "OK", "other", "OK")
+				l.Info("test", "status", "FAIL", "n", 1)
+				l.Info("test", "status", "TIMEOUT", "n", 1)
+				l.Info("test", slog.Group("g", "status", true), "n", 1)
+				l.Info("test", "n", 1, "status", "OK")
+			},
+			Want: `Nov 10 23:00:00.000 INF test status=OK   other=OK` + "\n" +
+				`Nov 10 23:00:00.000 INF test status=FAIL n=1` + "\n" +
+				`Nov 10 23:00:00.000 INF test status=TIMEOUT n=1` + "\n" +
+				`Nov 10 23:00:00.000 INF test g.status=true   n=1` + "\n" +
+				`Nov 10 23:00:00.000 INF test n=1 status=OK`,
+		},
+		{
+			Opts: &Options{
+				ZeroTimeText: "-",
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "zero", time.Time{}, "time", time.Date(2022, 11, 10, 23, 0, 0, 0, time.UTC))
+			},
+			Want: `Nov 10 23:00:00.000 INF test zero=- time="2022-11-10 23:00:00 +0000 UTC"`,
+		},
+		{
+			F: func(l *slog.Logger) {
+				l.Info("test", "zero", time.Time{})
+			},
+			Want: `Nov 10 23:00:00.000 INF test zero="0001-01-01 00:00:00 +0000 UTC"`,
+		},
+		{
+			Opts: &Options{
+				CoalesceGroupPrefix: true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", slog.Group("http", "method", "GET", "status", 200), "user", "bob")
+				l.Info("test", slog.Group("http", "method", "GET"), "user", "bob", slog.Group("http", "status", 200))
+				l.Info("test", slog.Group("http", "a", 1, slog.Group("req", "b", 2, "c", 3)))
+				l.Info("test", slog.Group("http", "a", 1, "err", errTest, "b", 2, "c", 3))
+				l.With("x", 0).WithGroup("g").With("a", 1, "b", 2).Info("test", "c", 3, "d", 4)
+			},
+			Want: `Nov 10 23:00:00.000 INF test http.{method=GET status=200} user=bob` + "\n" +
+				`Nov 10 23:00:00.000 INF test http.method=GET user=bob http.status=200` + "\n" +
+				`Nov 10 23:00:00.000 INF test http.a=1 http.req.{b=2 c=3}` + "\n" +
+				`Nov 10 23:00:00.000 INF test http.a=1 http.err=fail http.{b=2 c=3}` + "\n" +
+				`Nov 10 23:00:00.000 INF test x=0 g.{a=1 b=2} g.{c=3 d=4}`,
+		},
+		{
+			Opts: &Options{
+				Level:           slog.LevelDebug - 4,
+				LevelShortCodes: map[slog.Level]string{slog.LevelInfo + 2: "NTC", slog.LevelError + 4: "FTL", slog.LevelDebug - 4: "TRC"},
+			},
+			F: func(l *slog.Logger) {
+				l.Log(context.TODO(), slog.LevelDebug-4, "test")
+				l.Info("test")
+				l.Log(context.TODO(), slog.LevelInfo+2, "test")
+				l.Log(context.TODO(), slog.LevelInfo+1, "test")
+				l.Log(context.TODO(), slog.LevelError+4, "test")
+			},
+			Want: `Nov 10 23:00:00.000 TRC test` + "\n" +
+				`Nov 10 23:00:00.000 INF test` + "\n" +
+				`Nov 10 23:00:00.000 NTC test` + "\n" +
+				`Nov 10 23:00:00.000 INF+1 test` + "\n" +
+				`Nov 10 23:00:00.000 FTL test`,
+		},
+		{
+			Opts: &Options{
+				BadgeKeys: []string{"db", "svc.cache"},
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "db", true, slog.Group("svc", "cache", false), "other", true)
+				l.Info("test", "db", "up")
+			},
+			Want: `Nov 10 23:00:00.000 INF test db=[ ON] svc.cache=[OFF] other=true` + "\n" +
+				`Nov 10 23:00:00.000 INF test db=up`,
+		},
+		{
+			Opts: &Options{
+				BadgeKeys:  []string{"db"},
+				BadgeWidth: 5,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "db", true)
+				l.Info("test", "db", false)
+			},
+			Want: `Nov 10 23:00:00.000 INF test db=[   ON]` + "\n" +
+				`Nov 10 23:00:00.000 INF test db=[  OFF]`,
+		},
+		{
+			Opts: &Options{
+				InterpolateMessage: true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("user {user} logged in from {http.ip} {missing} {", "user", "bob", slog.Group("http", "ip", "::1"), "n", 1)
+				l.WithGroup("g").Info("{a} {{b}}", "a", "x y", "b", errTest)
+			},
+			Want: `Nov 10 23:00:00.000 INF user bob logged in from ::1 {missing} { user=bob http.ip=::1 n=1` + "\n" +
+				`Nov 10 23:00:00.000 INF x y {fail} g.a="x y" g.b=fail`,
+		},
+		{
+			Opts: &Options{
+				InterpolateMessage:     true,
+				InterpolateRemoveAttrs: true,
+				ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+					if a.Key == "secret" {
+						return slog.String(a.Key, "***")
+					}
+					return a
+				},
+			},
+			F: func(l *slog.Logger) {
+				l.Info("user {user} logged in with {secret} from {http.ip}", "user", "bob", "secret", "pw", slog.Group("http", "ip", "::1", "port", 80))
+				l.With("user", "alice").WithGroup("g").Info("{user} {a}", "a", 1, "b", 2)
+			},
+			Want: `Nov 10 23:00:00.000 INF user bob logged in with *** from ::1 http.port=80` + "\n" +
+				`Nov 10 23:00:00.000 INF {user} 1 user=alice g.b=2`,
+		},
+		{
+			Opts: &Options{
+				AttrDivider: "│",
+				ReplaceAttr: drop("secret"),
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "a", 1, "b", 2)
+				l.Info("test")
+				l.With("h", 1).Info("test")
+				l.With("h", 1).Info("test", "a", 1)
+				l.Info("test", "secret", "x")
+			},
+			Want: `Nov 10 23:00:00.000 INF test │ a=1 b=2` + "\n" +
+				`Nov 10 23:00:00.000 INF test` + "\n" +
+				`Nov 10 23:00:00.000 INF test h=1` + "\n" +
+				`Nov 10 23:00:00.000 INF test h=1 │ a=1` + "\n" +
+				`Nov 10 23:00:00.000 INF test`,
+		},
+		{
+			Opts: &Options{
+				NoQuote: true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "msg", "hello world", "eq", "a=b", "key with space", "x", "empty", "")
+			},
+			Want: `Nov 10 23:00:00.000 INF test msg=hello world eq=a=b "key with space"=x empty=`,
+		},
+		{
+			Opts: &Options{
+				NoQuote:        true,
+				LnavCompatible: true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "msg", "hello world")
+			},
+			Want: `2009-11-10T23:00:00.000Z INFO  test msg="hello world"`,
+		},
+		{
+			Opts: &Options{
+				KeyWidth: 6,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "a", 1, "method", "GET", "status", 200, "duration", "1s", "err", errTest)
+				l.WithGroup("g").Info("test", "id", 1)
+			},
+			Want: `Nov 10 23:00:00.000 INF test a     =1 method=GET status=200 duration=1s err=fail` + "\n" +
+				`Nov 10 23:00:00.000 INF test g.id  =1`,
+		},
+		{
+			Opts: &Options{
+				ReverseAttrs: true,
+			},
+			F: func(l *slog.Logger) {
+				l.With("h1", 1, "h2", 2).Info("test", "a", 1, "b", 2, slog.Group("g", "c", 3, "d", 4), "e", 5)
+			},
+			Want: `Nov 10 23:00:00.000 INF test h1=1 h2=2 e=5 g.c=3 g.d=4 b=2 a=1`,
+		},
+		{
+			Opts: &Options{
+				SortKeys:     true,
+				ReverseAttrs: true,
+			},
+			F: func(l *slog.Logger) {
+				l.With("z", 1, "y", 2).Info("test", "c", 1, "a", 2, slog.Group("b", "d", 3, "c", 4), "a", 5)
+			},
+			Want: `Nov 10 23:00:00.000 INF test y=2 z=1 a=2 a=5 b.c=4 b.d=3 c=1`,
+		},
+		{
+			Opts: &Options{
+				KeyValueSeparator: ": ",
+			},
+			F: func(l *slog.Logger) {
+				l.With("a", 1).Info("test", "eq", "a=b", "sep", "x: y", "colon", "x:y", "err", errTest, "key: x", 2)
+			},
+			Want: `Nov 10 23:00:00.000 INF test a: 1 eq: a=b sep: "x: y" colon: x:y err: fail "key: x": 2`,
+		},
+		{
+			Opts: &Options{
+				ExpandErrors: true,
+			},
+			F: func(l *slog.Logger) {
+				inner := errors.New("inner")
+				middle := fmt.Errorf("middle: %w", inner)
+				l.Error("test", "err", fmt.Errorf("outer: %w", middle), "key", "val")
+				l.Error("test", slog.Group("group", "err", fmt.Errorf("%w", fmt.Errorf("not found: %w", errTest))))
+				l.Error("test", "err", fmt.Errorf("outer (%w)", errTest))
+			},
+			Want: "Nov 10 23:00:00.000 ERR test err=outer cause=middle cause=inner key=val\n" +
+				"Nov 10 23:00:00.000 ERR test group.err=\"not found\" group.cause=fail\n" +
+				"Nov 10 23:00:00.000 ERR test err=\"outer (fail)\" cause=fail",
+		},
+		{
+			F: func(l *slog.Logger) {
+				l.WithGroup("http").With("route", "/users").Info("test",
+					slog.Group("request", "method", "GET", slog.Group("header", "content-type", "text/plain")),
+					slog.Group("response", "status_code", 200))
+			},
+			Want: "Nov 10 23:00:00.000 INF test http.route=/users http.request.method=GET " +
+				"http.request.header.content-type=text/plain http.response.status_code=200",
+		},
+		{
+			Opts: &Options{
+				MarshalJSON: true,
+			},
+			F: func(l *slog.Logger) {
+				type user struct {
+					Name  string `json:"name"`
+					Admin bool   `json:"admin"`
+				}
+				l.Info("test",
+					"map", map[string]int{"b": 2, "a": 1},
+					"user", user{Name: "a b", Admin: true},
+					"slice", []string{"x", "y"},
+					"inf", []float64{math.Inf(1)})
+			},
+			Want: `Nov 10 23:00:00.000 INF test map={"a":1,"b":2} user="{\"name\":\"a b\",\"admin\":true}" slice=["x","y"] inf=[+Inf]`,
+		},
+		{
+			F: func(l *slog.Logger) {
+				l.Info("test", "version", &version{1, 2}, "nil", (*version)(nil), "value", version{1, 2})
+			},
+			Want: `Nov 10 23:00:00.000 INF test version=v1.2 nil=<nil> value="{major:1 minor:2}"`,
+		},
+		{
+			Opts: &Options{
+				AnnotateKeyTypes: true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "n", 1, "u", uint(2), "f", 1.5, "b", true, "s", "x",
+					"d", time.Second, slog.Group("g", "ids", []int{1}), "u", &url.URL{Host: "h"}, "nil", nil)
+			},
+			Want: `Nov 10 23:00:00.000 INF test n<int64>=1 u<uint64>=2 f<float64>=1.5 b<bool>=true s<string>=x ` +
+				`d<duration>=1s g.ids<[]int>=[1] u<*url.URL>=//h nil<<nil>>=<nil>`,
+		},
+		{
+			Opts: &Options{
+				RightAlignNumbers: map[string]int{"n": 5, "g.f": 6, "s": 5},
+			},
+			F: func(l *slog.Logger) {
+				for _, n := range []int{1, 12345, 123456} {
+					l.Info("test", "n", n, slog.Group("g", "f", float64(n)/2), "s", "x")
+				}
+			},
+			Want: "Nov 10 23:00:00.000 INF test n=    1 g.f=   0.5 s=x\n" +
+				"Nov 10 23:00:00.000 INF test n=12345 g.f=6172.5 s=x\n" +
+				"Nov 10 23:00:00.000 INF test n=123456 g.f= 61728 s=x",
+		},
+		{
+			Opts: &Options{
+				InlineGroups: true,
+			},
+			F: func(l *slog.Logger) {
+				l.WithGroup("http").With(slog.Group("conn", "id", 1)).Info("test",
+					slog.Group("req", "method", "GET", slog.Group("header", "id", "a b"), slog.Group("empty")),
+					"err", errTest, slog.Group("", "flat", true))
+			},
+			Want: `Nov 10 23:00:00.000 INF test http.conn={id=1} http.req={method=GET header={id="a b"}} http.err=fail http.flat=true`,
+		},
+		{
+			Opts: &Options{
+				GroupsAsJSON: true,
+				InlineGroups: true,
+			},
+			F: func(l *slog.Logger) {
+				l.WithGroup("http").Info("test",
+					slog.Group("flat", "a", 1, "b", "x", "ok", true, "f", 1.5, "nan", math.NaN()),
+					slog.Group("req", "method", "GET", slog.Group("header", "id", "a b", "d", time.Second),
+						slog.Group("", "inlined", uint(2)), slog.Group("empty")),
+					slog.Group("empty"), "k", "v")
+			},
+			Want: `Nov 10 23:00:00.000 INF test http.flat={"a":1,"b":"x","ok":true,"f":1.5,"nan":"NaN"} ` +
+				`http.req="{\"method\":\"GET\",\"header\":{\"id\":\"a b\",\"d\":\"1s\"},\"inlined\":2}" http.k=v`,
+		},
+		{
+			Opts: &Options{
+				LnavCompatible: true,
+				CardMode:       true,
+				NoTime:         true,
+				HideAttrs:      true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "key", "val", "n", 1)
+			},
+			Want: `2009-11-10T23:00:00.000Z INFO  test key=val n=1`,
+		},
+		{
+			Opts: &Options{
+				LnavCompatible: true,
+				ShowUptime:     true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "key", "val")
+			},
+			Want: `2009-11-10T23:00:00.000Z INFO  test key=val`,
+		},
+		{
+			Opts: &Options{
+				LnavCompatible: true,
+				AddMonotonic:   true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "key", "val")
+			},
+			Want: `2009-11-10T23:00:00.000Z INFO  test key=val`,
+		},
+		{
+			Opts: &Options{
+				LnavCompatible:  true,
+				LevelShortCodes: map[slog.Level]string{slog.LevelInfo: "i"},
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "key", "val")
+			},
+			Want: `2009-11-10T23:00:00.000Z INFO  test key=val`,
+		},
+		{
+			Opts: &Options{
+				LnavCompatible: true,
+				KeyWidth:       10,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "key", "val")
+			},
+			Want: `2009-11-10T23:00:00.000Z INFO  test key=val`,
+		},
+		{
+			Opts: &Options{
+				LnavCompatible:   true,
+				AnnotateKeyTypes: true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", "key", "val", "n", 1)
+			},
+			Want: `2009-11-10T23:00:00.000Z INFO  test key=val n=1`,
+		},
+		{
+			Opts: &Options{
+				LnavCompatible:      true,
+				CoalesceGroupPrefix: true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("test", slog.Group("http", "method", "GET", "status", 200))
+			},
+			Want: `2009-11-10T23:00:00.000Z INFO  test http.method=GET http.status=200`,
+		},
+		{
+			Opts: &Options{
+				LnavCompatible: true,
+				HTMLOutput:     true,
+			},
+			F: func(l *slog.Logger) {
+				l.Info("a<b", "q", "x&y")
+			},
+			Want: `2009-11-10T23:00:00.000Z INFO  a<b q=x&y`,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buf bytes.Buffer
+			if test.Opts == nil {
+				test.Opts = &Options{}
+			}
+			test.Opts.NoColor = true
+			l := slog.New(NewHandler(&buf, test.Opts))
+			test.F(l)
+
+			got := strings.TrimRight(buf.String(), "\n")
+			if test.Want != got {
+				t.Fatalf("(-want +got)\n- %s\n+ %s", test.Want, got)
+			}
+		})
+	}
+}
+
+// drop returns a ReplaceAttr that drops the given keys.
+func drop(keys ...string) func([]string, slog.Attr) slog.Attr {
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) > 0 {
+			return a
+		}
+
+		for _, key := range keys {
+			if a.Key == key {
+				a = slog.Attr{}
+			}
+		}
+		return a
+	}
+}
+
+func replace(new slog.Value, keys ...string) func([]string, slog.Attr) slog.Attr {
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) > 0 {
+			return a
+		}
+
+		for _, key := range keys {
+			if a.Key == key {
+				a.Value = new
+			}
+		}
+		return a
+	}
+}
+
+func TestReplaceAttr(t *testing.T) {
+	tests := [][]any{
+		{},
+		{"key", "val"},
+		{"key", "val", slog.Group("group", "key2", "val2")},
+		{"key", "val", slog.Group("group", "key2", "val2", slog.Group("group2", "key3", "val3"))},
+	}
+
+	type replaceAttrParams struct {
+		Groups []string
+		Attr   slog.Attr
+	}
+
+	replaceAttrRecorder := func(record *[]replaceAttrParams) func([]string, slog.Attr) slog.Attr {
+		return func(groups []string, a slog.Attr) slog.Attr {
+			*record = append(*record, replaceAttrParams{groups, a})
+			return a
+		}
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			slogRecord := make([]replaceAttrParams, 0)
+			slogLogger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{
+				ReplaceAttr: replaceAttrRecorder(&slogRecord),
+			}))
+			slogLogger.Log(context.TODO(), slog.LevelInfo, "", test...)
+
+			tintRecord := make([]replaceAttrParams, 0)
+			tintLogger := slog.New(NewHandler(io.Discard, &Options{
+				ReplaceAttr: replaceAttrRecorder(&tintRecord),
+			}))
+			tintLogger.Log(context.TODO(), slog.LevelInfo, "", test...)
+
+			if !slices.EqualFunc(slogRecord, tintRecord, func(a, b replaceAttrParams) bool {
+				return slices.Equal(a.Groups, b.Groups) && a.Attr.Equal(b.Attr)
+			}) {
+				t.Fatalf("(-want +got)\n- %v\n+ %v", slogRecord, tintRecord)
+			}
+		})
+	}
+}
+
+func TestFramedOutput(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:  drop(slog.TimeKey),
+		NoColor:      true,
+		FramedOutput: true,
+	}))
+	l.Info("first", "key", "val")
+	l.Info("multi\nline")
+	l.Error("third", "err", errTest)
+
+	want := []string{
+		"INF first key=val",
+		"INF multi\nline",
+		"ERR third err=fail",
+	}
+
+	var got []string
+	data := buf.Bytes()
+	for len(data) > 0 {
+		if len(data) < 4 {
+			t.Fatalf("truncated frame header: %q", data)
+		}
+		n := int(binary.LittleEndian.Uint32(data))
+		data = data[4:]
+		if len(data) < n {
+			t.Fatalf("truncated frame: want %d bytes, have %d", n, len(data))
+		}
+		got = append(got, string(data[:n]))
+		data = data[n:]
+	}
+
+	if !slices.Equal(want, got) {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestColorKeysByKind(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:     drop(slog.TimeKey),
+		ColorKeysByKind: true,
+		KindKeyColors:   map[slog.Kind]string{slog.KindBool: "\033[35m"},
+	}))
+	l.Info("test", "str", "val", "num", 42, "ok", true, "any", []int{1}, "err", errTest)
+
+	want := "\033[92mINF\033[0m test " +
+		"\033[32;2mstr=\033[0mval " +
+		"\033[36;2mnum=\033[0m42 " +
+		"\033[35mok=\033[0mtrue " +
+		"\033[2many=\033[22m[1] " +
+		"\033[91;2merr=\033[22mfail\033[0m\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestSourceMinLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		AddSource:      true,
+		SourceMinLevel: slog.LevelWarn,
+		ReplaceAttr:    drop(slog.TimeKey),
+		NoColor:        true,
+	}))
+	l.Info("test")
+	l.Error("test")
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 lines, got %q", lines)
+	}
+	if want := "INF test"; lines[0] != want {
+		t.Fatalf("(-want +got)\n- %s\n+ %s", want, lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "ERR ") || !strings.Contains(lines[1], "/handler_test.go:") {
+		t.Fatalf("want source on error line, got %q", lines[1])
+	}
+}
+
+func TestSourceBaseDir(t *testing.T) {
+	tests := []struct {
+		BaseDir string
+		File    string
+		Want    string
+	}{
+		{"/src/app", "/src/app/internal/db/conn.go", "internal/db/conn.go:42"},
+		{"/src/app/", "/src/app/main.go", "main.go:42"},
+		{"/src/app", "/src/application/main.go", "application/main.go:42"},
+		{"/src/app", "/go/pkg/mod/lib/lib.go", "lib/lib.go:42"},
+		{"", "/src/app/internal/db/conn.go", "db/conn.go:42"},
+		{"/", "/src/app/main.go", "src/app/main.go:42"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			h := NewHandler(io.Discard, &Options{
+				NoColor:       true,
+				SourceBaseDir: filepath.FromSlash(test.BaseDir),
+			}).(*Handler)
+
+			buf := newBuffer()
+			defer buf.Free()
+			h.appendSource(buf, &slog.Source{File: filepath.FromSlash(test.File), Line: 42})
+
+			if want, got := filepath.FromSlash(test.Want), string(*buf); want != got {
+				t.Fatalf("(-want +got)\n- %s\n+ %s", want, got)
+			}
+		})
+	}
+}
+
+func TestShowMessageHash(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:     drop(slog.TimeKey, slog.LevelKey),
+		NoColor:         true,
+		ShowMessageHash: true,
+	}))
+	l.Info("connected", "attempt", 1)
+	l.Info("connected", "attempt", 2)
+	l.Info("disconnected")
+
+	msgid := func(line string) string {
+		_, id, ok := strings.Cut(line, "msgid=")
+		if !ok || len(id) != 6 {
+			t.Fatalf("missing msgid in %q", line)
+		}
+		return id
+	}
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("want 3 lines, got %q", lines)
+	}
+	if want := "connected attempt=1 msgid=" + msgid(lines[0]); lines[0] != want {
+		t.Fatalf("(-want +got)\n- %s\n+ %s", want, lines[0])
+	}
+	if msgid(lines[0]) != msgid(lines[1]) {
+		t.Fatalf("want same msgid for same message, got %q", lines[:2])
+	}
+	if msgid(lines[0]) == msgid(lines[2]) {
+		t.Fatalf("want different msgid for different messages, got %q", lines)
+	}
+}
+
+func TestShowAbsoluteAndRelativeTime(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &Options{
+		TimeFormat:                  time.TimeOnly,
+		NoColor:                     true,
+		ShowAbsoluteAndRelativeTime: true,
+	})
+
+	for _, d := range []time.Duration{0, 12 * time.Millisecond, 1500 * time.Millisecond} {
+		r := slog.NewRecord(testTime.Add(d), slog.LevelInfo, "test", 0)
+		if err := h.WithAttrs([]slog.Attr{slog.Int("key", 1)}).Handle(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "00:00:00 (+0s) INF test key=1\n" +
+		"00:00:00 (+12ms) INF test key=1\n" +
+		"00:00:01 (+1.488s) INF test key=1\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestStartupBanner(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &Options{
+		TimeFormat:    "2006",
+		NoColor:       true,
+		ReplaceAttr:   drop(slog.TimeKey),
+		StartupBanner: "myapp",
+	})
+
+	want := "--- myapp pid=" + strconv.Itoa(os.Getpid()) + " " + time.Now().Format("2006") + " ---\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	l := slog.New(h)
+	l.Info("test")
+	l.WithGroup("group").Info("test")
+
+	want += "INF test\nINF test\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestStartupBannerClock(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(io.Discard, &Options{
+		TimeFormat:   time.Kitchen,
+		NoColor:      true,
+		TimeLocation: time.FixedZone("UTC+2", 2*60*60),
+	}).(*Handler)
+	h.w = &buf
+	h.now = func() time.Time { return testTime }
+	if err := h.writeBanner("myapp"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "--- myapp pid=" + strconv.Itoa(os.Getpid()) + " 2:00AM ---\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestColors(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		Colors: Colors{
+			Info:       "\033[34m",
+			Message:    "\033[1m",
+			Key:        "\033[36m",
+			ErrorValue: "\033[31m",
+		},
+	}))
+	l.Info("test", "key", "val", "err", errTest)
+	l.Warn("test")
+
+	want := "\033[34mINF\033[0m \033[1mtest\033[0m \033[36mkey=\033[0mval \033[91;2merr=\033[0m\033[31mfail\033[0m\n" +
+		"\033[93mWRN\033[0m \033[1mtest\033[0m\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestRainbowKeys(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey, slog.LevelKey),
+		RainbowKeys: true,
+	}))
+	keys := []string{"alpha", "beta", "gamma", "delta", "epsilon"}
+	for i := 0; i < 2; i++ {
+		for _, key := range keys {
+			l.Info("test", key, 1)
+		}
+	}
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	colors := make(map[string]bool)
+	for i, key := range keys {
+		color, _, _ := strings.Cut(strings.TrimPrefix(lines[i], "test "), key+"=")
+		if !slices.Contains(defaultKeyPalette, color) {
+			t.Fatalf("key %q: color %q not in palette", key, color)
+		}
+		if lines[i] != lines[i+len(keys)] {
+			t.Fatalf("key %q: want stable color, got %q and %q", key, lines[i], lines[i+len(keys)])
+		}
+		colors[color] = true
+	}
+	if len(colors) < 2 {
+		t.Fatalf("want distinct colors for distinct keys, got %v", colors)
+	}
+
+	buf.Reset()
+	l = slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey, slog.LevelKey),
+		RainbowKeys: true,
+		KeyPalette:  []string{"\033[31m"},
+		NoColor:     true,
+	}))
+	l.Info("test", "key", 1)
+	if want, got := "test key=1\n", buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestCoalesceErrors(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &Options{
+		NoColor:        true,
+		ReplaceAttr:    drop(slog.TimeKey),
+		CoalesceErrors: time.Second,
+	})
+
+	now := testTime
+	h.(*Handler).now = func() time.Time { return now }
+
+	l := slog.New(h)
+	for _, d := range []time.Duration{
+		0,                       // first occurrence, logged
+		500 * time.Millisecond,  // suppressed
+		999 * time.Millisecond,  // suppressed
+		time.Second,             // window passed, logged with count
+		1500 * time.Millisecond, // suppressed
+		3 * time.Second,         // window passed, logged with count
+		5 * time.Second,         // window passed without duplicates, logged
+	} {
+		now = testTime.Add(d)
+		l.Error("test", "err", errTest)
+	}
+	l.Error("other", "err", errors.New("other"))
+	l.Info("no error")
+
+	want := "ERR test err=fail\n" +
+		"ERR test err=fail count=3\n" +
+		"ERR test err=fail count=2\n" +
+		"ERR test err=fail\n" +
+		"ERR other err=other\n" +
+		"INF no error\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestTimeFormatName(t *testing.T) {
+	tests := []struct {
+		Name TimeFormatName
+		Want string
+	}{
+		{TimeFormatRFC3339, "2022-11-10T23:00:00Z"},
+		{TimeFormatRFC3339Nano, "2022-11-10T23:00:00.123456789Z"},
+		{TimeFormatKitchen, "11:00PM"},
+		{TimeFormatDateTime, "2022-11-10 23:00:00"},
+		{TimeFormatTimeOnly, "23:00:00"},
+		{TimeFormatStampMilli, "Nov 10 23:00:00.123"},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buf bytes.Buffer
+			h := NewHandler(&buf, &Options{
+				TimeFormat:     time.Kitchen + " ignored",
+				TimeFormatName: test.Name,
+				NoColor:        true,
+			})
+
+			r := slog.NewRecord(time.Date(2022, 11, 10, 23, 0, 0, 123456789, time.UTC), slog.LevelInfo, "test", 0)
+			if err := h.Handle(context.Background(), r); err != nil {
+				t.Fatal(err)
+			}
+
+			want := test.Want + " INF test\n"
+			if got := buf.String(); want != got {
+				t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+			}
+		})
+	}
+}
+
+func TestDebugAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:    true,
+		DebugAttrs: true,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "secret" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	l.With("a", 1, "secret", "x").Info("test", "b", 2, slog.Group("g", "secret", "y", "c", 3))
+	l.Info("test")
+
+	want := "INF test a=1 b=2 g.c=3 (rendered 3/5)\n" +
+		"INF test (rendered 0/0)\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestCardMode(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:     true,
+		ReplaceAttr: drop(slog.TimeKey),
+		CardMode:    true,
+	}))
+
+	l.With("a", 1).Info("test", "b", "two words", "err", errTest, slog.Group("g", "c", 3))
+	l.Info("no attrs")
+
+	want := "INF test\n" +
+		"  a=1\n" +
+		"  b=\"two words\"\n" +
+		"  err=fail\n" +
+		"  g.c=3\n" +
+		"INF no attrs\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	buf.Reset()
+	l = slog.New(NewHandler(&buf, &Options{
+		NoColor:     true,
+		ReplaceAttr: drop(slog.TimeKey),
+		CardMode:    true,
+		Indent:      "\t",
+	}))
+	l.Info("test", "a", 1)
+
+	want = "INF test\n\ta=1\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestMultilineAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:            true,
+		ReplaceAttr:        drop(slog.TimeKey),
+		MultilineAttrs:     true,
+		MultilineThreshold: 2,
+		Indent:             "    ",
+	}))
+
+	l.Info("short", "a", 1, "b", 2)
+	l.Info("long", "a", 1, "b", 2, slog.Group("g", "c", 3))
+	l.With("a", 1).WithGroup("g").Info("derived", "b", 2, "c", "two words")
+	l.With("a", 1).Info("derived", "b", 2)
+
+	want := "INF short a=1 b=2\n" +
+		"INF long\n" +
+		"    a=1\n" +
+		"    b=2\n" +
+		"    g.c=3\n" +
+		"INF derived\n" +
+		"    a=1\n" +
+		"    g.b=2\n" +
+		"    g.c=\"two words\"\n" +
+		"INF derived a=1 b=2\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestHexdumpBytes(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:          true,
+		ReplaceAttr:      drop(slog.TimeKey),
+		HexdumpBytes:     true,
+		HexdumpThreshold: 4,
+	}))
+
+	l.Info("test", "small", []byte{1, 2, 3, 4}, "n", 1)
+	l.Info("test", "large", []byte("hello, world!\x00\x01\xffpayload"), "n", 1)
+	l.Info("test", "n", 1, "last", []byte("hello"))
+
+	want := "INF test small=\"[1 2 3 4]\" n=1\n" +
+		"INF test large=\n" +
+		"  00000000  68 65 6c 6c 6f 2c 20 77  6f 72 6c 64 21 00 01 ff  |hello, world!...|\n" +
+		"  00000010  70 61 79 6c 6f 61 64                              |payload|\n" +
+		"  n=1\n" +
+		"INF test n=1 last=\n" +
+		"  00000000  68 65 6c 6c 6f                                    |hello|\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestHighlightQuoted(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:     drop(slog.TimeKey),
+		HighlightQuoted: true,
+	}))
+	l.Info("test", "a", "two words", "b", "word")
+
+	want := "\033[92mINF\033[0m test " +
+		"\033[2ma=\033[22m\033[2m\"\033[22mtwo words\033[2m\"\033[22m " +
+		"\033[2mb=\033[22mword\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	buf.Reset()
+	l = slog.New(NewHandler(&buf, &Options{
+		NoColor:         true,
+		ReplaceAttr:     drop(slog.TimeKey),
+		HighlightQuoted: true,
+	}))
+	l.Info("test", "a", "two words")
+
+	want = "INF test a=\"two words\"\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestShowRate(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &Options{
+		NoColor:     true,
+		ReplaceAttr: drop(slog.TimeKey),
+		ShowRate:    []string{"requests", "http.bytes"},
+	})
+
+	now := testTime
+	h.(*Handler).now = func() time.Time { return now }
+
+	l := slog.New(h)
+	l.Info("test", "requests", 1000, "other", 1)
+	now = now.Add(2 * time.Second)
+	l.Info("test", "requests", 1100, "other", 2)
+	now = now.Add(3 * time.Second)
+	l.Info("test", "requests", 1090)
+	l.WithGroup("http").Info("test", "bytes", 1.5)
+	now = now.Add(time.Second)
+	l.WithGroup("http").Info("test", "bytes", 2.5)
+
+	want := "INF test requests=1000 other=1\n" +
+		"INF test requests=1100 (+50/s) other=2\n" +
+		"INF test requests=1090 (-3.33/s)\n" +
+		"INF test http.bytes=1.5\n" +
+		"INF test http.bytes=2.5 (+1/s)\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestMinimalTheme(t *testing.T) {
+	var buf bytes.Buffer
+	opts := MinimalTheme()
+	opts.Level = slog.LevelDebug - 4
+	l := slog.New(NewHandler(&buf, opts))
+
+	l.Log(context.Background(), slog.LevelDebug-4, "trace", "a", 1)
+	l.Debug("debug", "a", 1)
+	l.Info("info", "a", 1)
+	l.With("b", 2).Warn("warn", "err", errTest)
+	l.Error("error", slog.Group("g", "a", 1))
+
+	want := "\033[2mT\033[0m \033[1mtrace\033[0m\n" +
+		"\033[95;2mD\033[0m \033[1mdebug\033[0m\n" +
+		"\033[92mI\033[0m \033[1minfo\033[0m\n" +
+		"\033[93mW\033[0m \033[1mwarn\033[0m\n" +
+		"\033[91mE\033[0m \033[1merror\033[0m\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestColorScope(t *testing.T) {
+	tests := []struct {
+		Scope ColorScope
+		Want  string
+	}{
+		{
+			ColorScopeAll,
+			"\033[2mMay  1 00:00:00.000\033[22m \033[92mINF\033[0m test \033[2ma=\033[22m1 \033[91;2merr=\033[22mfail\033[0m\n",
+		},
+		{
+			ColorScopeLevelAndErrors,
+			"May  1 00:00:00.000 \033[92mINF\033[0m test a=1 \033[91;2merr=\033[22mfail\033[0m\n",
+		},
+		{
+			ColorScopeLevelOnly,
+			"May  1 00:00:00.000 \033[92mINF\033[0m test a=1 err=fail\n",
+		},
+		{
+			ColorScopeNone,
+			"May  1 00:00:00.000 INF test a=1 err=fail\n",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buf bytes.Buffer
+			h := NewHandler(&buf, &Options{ColorScope: test.Scope})
+
+			r := slog.NewRecord(testTime, slog.LevelInfo, "test", 0)
+			r.AddAttrs(slog.Int("a", 1), slog.Any("err", errTest))
+			if err := h.Handle(context.Background(), r); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := buf.String(); test.Want != got {
+				t.Fatalf("(-want +got)\n- %q\n+ %q", test.Want, got)
+			}
+		})
+	}
+}
+
+func TestStructuredTrailer(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:       drop(slog.TimeKey),
+		StructuredTrailer: true,
+	}))
+	l.With("a", 1).WithGroup("g").Info("test", "b", "two words", "c", "x\x1ey")
+
+	human, machine, ok := strings.Cut(buf.String(), "\x1e")
+	if !ok {
+		t.Fatalf("no record separator in %q", buf.String())
+	}
+
+	wantHuman := "\033[92mINF\033[0m test \033[2ma=\033[22m1 \033[2mg.b=\033[22m\"two words\" \033[2mg.c=\033[22m\"x\\x1ey\" "
+	if wantHuman != human {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", wantHuman, human)
+	}
+	wantMachine := "level=INFO msg=test a=1 g.b=\"two words\" g.c=\"x\\x1ey\"\n"
+	if wantMachine != machine {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", wantMachine, machine)
+	}
+}
+
+func TestStructuredTrailerMessage(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:       drop(slog.TimeKey),
+		NoColor:           true,
+		NoQuote:           true,
+		StructuredTrailer: true,
+	}))
+	l.Info("a\x1eb", "c", "x\x1ey")
+
+	human, machine, _ := strings.Cut(buf.String(), "\x1e")
+	wantHuman := `INF a\x1eb c=x\x1ey `
+	if wantHuman != human {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", wantHuman, human)
+	}
+	wantMachine := "level=INFO msg=\"a\\x1eb\" c=\"x\\x1ey\"\n"
+	if wantMachine != machine {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", wantMachine, machine)
+	}
+}
+
+func TestShowUptime(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		ShowUptime:  true,
+	}).(*Handler)
+
+	now := testTime
+	h.start = now
+	h.now = func() time.Time { return now }
+
+	l := slog.New(h)
+	l.Info("test")
+	now = now.Add(3*time.Hour + 12*time.Minute + 1500*time.Microsecond)
+	l.Info("test")
+
+	want := "\033[2muptime=0s\033[22m \033[92mINF\033[0m test\n" +
+		"\033[2muptime=3h12m0.001s\033[22m \033[92mINF\033[0m test\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	buf.Reset()
+	h = NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		NoColor:     true,
+		ShowUptime:  true,
+	}).(*Handler)
+	h.start = testTime
+	h.now = func() time.Time { return now }
+	slog.New(h).Info("test")
+
+	want = "uptime=3h12m0.001s INF test\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestAddMonotonic(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &Options{
+		NoColor:      true,
+		ReplaceAttr:  drop(slog.TimeKey),
+		AddMonotonic: true,
+	}).(*Handler)
+
+	// fake monotonic source
+	now := time.Now()
+	h.monoStart = now
+	h.now = func() time.Time {
+		now = now.Add(1500 * time.Nanosecond)
+		return now
+	}
+
+	l := slog.New(h)
+	l.Info("test")
+	l.With("a", 1).Info("test")
+	l.Info("test")
+
+	want := "mono=1500 INF test\n" +
+		"mono=3000 INF test a=1\n" +
+		"mono=4500 INF test\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	var prev int64
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		mono, err := strconv.ParseInt(strings.Fields(strings.TrimPrefix(line, "mono="))[0], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mono < prev {
+			t.Fatalf("want nondecreasing monotonic time, got %d after %d", mono, prev)
+		}
+		prev = mono
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &Options{
+		RelativeTime: true,
+	}).(*Handler)
+	h.elapsedStart = testTime
+
+	for i, d := range []time.Duration{0, 1234 * time.Millisecond, 2*time.Minute + 5*time.Millisecond} {
+		r := slog.NewRecord(testTime.Add(d), slog.LevelInfo, "test", 0)
+		var hh slog.Handler = h
+		if i > 0 {
+			hh = h.WithAttrs([]slog.Attr{slog.Int("i", i)})
+		}
+		if err := hh.Handle(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "\033[2m+0s\033[22m \033[92mINF\033[0m test\n" +
+		"\033[2m+1.234s\033[22m \033[92mINF\033[0m test \033[2mi=\033[22m1\n" +
+		"\033[2m+2m0.005s\033[22m \033[92mINF\033[0m test \033[2mi=\033[22m2\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+// failWriter is a writer that always fails
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) { return 0, errTest }
+
+func TestBufferWrites(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &Options{
+		ReplaceAttr:  drop(slog.TimeKey),
+		NoColor:      true,
+		BufferWrites: true,
+	})
+	l := slog.New(h)
+	l.Info("a")
+	l.With("k", "v").Info("b")
+	if got := buf.String(); got != "" {
+		t.Fatalf("want output buffered, got %q", got)
+	}
+
+	if err := h.(Flusher).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "INF a\nINF b k=v\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	h = NewHandler(failWriter{}, &Options{BufferWrites: true})
+	slog.New(h).Info("a")
+	if err := h.(Flusher).Flush(); !errors.Is(err, errTest) {
+		t.Fatalf("want %v, got %v", errTest, err)
+	}
+	if err := NewTintHandler(&buf, nil).Flush(); err != nil {
+		t.Fatalf("want unbuffered flush to do nothing, got %v", err)
+	}
+}
+
+func TestBytesFormat(t *testing.T) {
+	tests := []struct {
+		Format BytesFormat
+		Want   string
+	}{
+		{BytesFormatDefault, `INF test b="[104 105]" s="[104 32 105]" nil=[]`},
+		{BytesFormatHex, `INF test b=6869 s=682069 nil=""`},
+		{BytesFormatBase64, `INF test b="aGk=" s=aCBp nil=""`},
+		{BytesFormatQuoted, `INF test b="hi" s="h i" nil=""`},
+		{BytesFormatRaw, `INF test b=hi s="h i" nil=""`},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buf bytes.Buffer
+			l := slog.New(NewHandler(&buf, &Options{
+				ReplaceAttr: drop(slog.TimeKey),
+				NoColor:     true,
+				BytesFormat: test.Format,
+			}))
+			l.Info("test", "b", []byte("hi"), "s", []byte("h i"), "nil", []byte(nil))
+
+			if got := buf.String(); test.Want+"\n" != got {
+				t.Fatalf("(-want +got)\n- %q\n+ %q", test.Want+"\n", got)
+			}
+		})
+	}
+}
+
+func TestPlainAttrTail(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:     drop(slog.TimeKey),
+		PlainAttrTail:   true,
+		HighlightQuoted: true,
+		Colors:          Colors{Message: ansiBold},
+	}))
+	l.With("a", 1).WithGroup("g").Warn("test", "err", errTest, "level", slog.LevelError, "s", "x y")
+
+	want := "\033[93mWRN\033[0m \033[1mtest\033[0m a=1 g.err=fail g.level=ERR g.s=\"x y\"\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+	if _, tail, _ := strings.Cut(buf.String(), "test\033[0m"); strings.Contains(tail, "\033") {
+		t.Fatalf("want no escapes after the message, got %q", tail)
+	}
+}
+
+func TestEmptyGroups(t *testing.T) {
+	dropped := func(groups []string, a slog.Attr) slog.Attr {
+		if a.Key == "drop" || a.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		return a
+	}
+
+	tests := []struct {
+		Opts Options
+		Want string
+	}{
+		{
+			Want: "INF test k=1 g.j.k=2\nINF test\n",
+		},
+		{
+			Opts: Options{CoalesceGroupPrefix: true},
+			Want: "INF test k=1 g.j.k=2\nINF test\n",
+		},
+		{
+			Opts: Options{InlineGroups: true},
+			Want: "INF test k=1 g={j={k=2}}\nINF test\n",
+		},
+		{
+			Opts: Options{GroupsAsJSON: true},
+			Want: `INF test k=1 g={"j":{"k":2}}` + "\nINF test\n",
+		},
+		{
+			Opts: Options{MaxGroupDepth: 1},
+			Want: "INF test k=1 g.j{…1 field}\nINF test\n",
+		},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buf bytes.Buffer
+			test.Opts.ReplaceAttr = dropped
+			test.Opts.NoColor = true
+			l := slog.New(NewHandler(&buf, &test.Opts))
+			l.Info("test", slog.Group("e", "drop", 1), "k", 1,
+				slog.Group("g", slog.Group("i", "drop", 2), slog.Group("j", "drop", 3, "k", 2), slog.Group("empty")))
+			l.With(slog.Group("e", "drop", 1)).Info("test", slog.Group("g", slog.Group("i", "drop", 2)))
+
+			if got := buf.String(); test.Want != got {
+				t.Fatalf("(-want +got)\n- %q\n+ %q", test.Want, got)
+			}
+		})
+	}
+}
+
+func TestDimTailAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:  drop(slog.TimeKey),
+		DimTailAttrs: 2,
+	}))
+	l.With("a", 1).Info("test", "b", 2, slog.Group("g", "c", 3, "d", 4), "err", errTest)
+
+	want := "\033[92mINF\033[0m test \033[2ma=\033[22m1 \033[2mb=\033[22m2 " +
+		"\033[2mg.c=\033[22m\033[2m3\033[0m \033[2mg.d=\033[22m\033[2m4\033[0m " +
+		"\033[91;2merr=\033[22mfail\033[0m\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	buf.Reset()
+	l = slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:  drop(slog.TimeKey),
+		NoColor:      true,
+		DimTailAttrs: 1,
+	}))
+	l.Info("test", "a", 1, "b", 2)
+
+	want = "INF test a=1 b=2\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestLevelChip(t *testing.T) {
+	log := func(l *slog.Logger) {
+		l.Log(context.TODO(), slog.LevelDebug-4, "trace")
+		l.Debug("debug")
+		l.Info("info")
+		l.Warn("warn")
+		l.Error("error")
+		l.Log(context.TODO(), slog.LevelError+1, "error+1")
+	}
+
+	var buf bytes.Buffer
+	log(slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		Level:       slog.LevelDebug - 4,
+		LevelChip:   true,
+	})))
+
+	want := "\033[2m\033[7m TRACE \033[0m trace\n" +
+		"\033[95;2m\033[7m DEBUG \033[0m debug\n" +
+		"\033[92m\033[7m INFO  \033[0m info\n" +
+		"\033[93m\033[7m WARN  \033[0m warn\n" +
+		"\033[91m\033[7m ERROR \033[0m error\n" +
+		"\033[91m\033[7m ERROR+1 \033[0m error+1\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	buf.Reset()
+	log(slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:      drop(slog.TimeKey),
+		Level:            slog.LevelDebug - 4,
+		NoColor:          true,
+		LevelChip:        true,
+		LevelChipPadding: 2,
+	})))
+
+	want = "TRACE trace\nDEBUG debug\nINFO  info\nWARN  warn\nERROR error\nERROR+1 error+1\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	buf.Reset()
+	slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:      drop(slog.TimeKey),
+		LevelChip:        true,
+		LevelChipPadding: 2,
+	})).Info("info")
+
+	want = "\033[92m\033[7m  INFO   \033[0m info\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewTintHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		NoColor:     true,
+		Level:       slog.LevelWarn,
+	})
+	l := slog.New(h).With("a", 1)
+	l.Info("hidden")
+	if got := h.GetLevel(); got != slog.LevelWarn {
+		t.Fatalf("want level %v, got %v", slog.LevelWarn, got)
+	}
+
+	h.SetLevel(slog.LevelDebug)
+	l.Debug("shown")
+	if got := l.Handler().(*Handler).GetLevel(); got != slog.LevelDebug {
+		t.Fatalf("want derived level %v, got %v", slog.LevelDebug, got)
+	}
+
+	want := "DBG shown a=1\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	// set the level concurrently with logging, for the race detector
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			h.SetLevel(slog.Level(i % 8))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		l.Info("test")
+	}
+	wg.Wait()
+}
+
+func TestWithIndent(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewTintHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		NoColor:     true,
+		Indent:      "| ",
+		IndentDepth: 1,
+	})
+	child := h.WithIndent()
+	grandchild := child.WithIndent()
+
+	slog.New(h).Info("outer")
+	slog.New(child).With("a", 1).Info("inner")
+	slog.New(grandchild).WithGroup("g").Info("innermost", "b", 2)
+	slog.New(child).Info("inner")
+
+	want := "| INF outer\n" +
+		"| | INF inner a=1\n" +
+		"| | | INF innermost g.b=2\n" +
+		"| | INF inner\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestWithIndentLnav(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewTintHandler(&buf, &Options{
+		ReplaceAttr:    drop(slog.TimeKey),
+		IndentDepth:    1,
+		LnavCompatible: true,
+	})
+	slog.New(h).Info("outer")
+	slog.New(h.WithIndent()).Info("inner")
+
+	want := "INFO  outer\nINFO  inner\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestMessageColor(t *testing.T) {
+	const cyan = "\033[1;36m"
+	upper := func(groups []string, a slog.Attr) slog.Attr {
+		switch a.Key {
+		case slog.TimeKey, slog.LevelKey:
+			return slog.Attr{}
+		case slog.MessageKey:
+			return slog.String(a.Key, strings.ToUpper(a.Value.String()))
+		}
+		return a
+	}
+
+	tests := []struct {
+		Opts Options
+		Want string
+	}{
+		{
+			Opts: Options{MessageColor: cyan, ReplaceAttr: drop(slog.TimeKey, slog.LevelKey)},
+			Want: cyan + "test\033[0m \033[2mk=\033[22m1\n",
+		},
+		{
+			Opts: Options{MessageColor: cyan, ReplaceAttr: upper},
+			Want: cyan + "TEST\033[0m \033[2mk=\033[22m1\n",
+		},
+		{
+			Opts: Options{MessageColor: cyan, Colors: Colors{Message: ansiBold}, ReplaceAttr: drop(slog.TimeKey, slog.LevelKey)},
+			Want: ansiBold + "test\033[0m \033[2mk=\033[22m1\n",
+		},
+		{
+			Opts: Options{MessageColor: cyan, NoColor: true, ReplaceAttr: upper},
+			Want: "TEST k=1\n",
+		},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buf bytes.Buffer
+			slog.New(NewHandler(&buf, &test.Opts)).Info("test", "k", 1)
+
+			if got := buf.String(); test.Want != got {
+				t.Fatalf("(-want +got)\n- %q\n+ %q", test.Want, got)
+			}
+		})
+	}
+}
+
+func TestMaxLinesPerSecond(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &Options{
+		ReplaceAttr:       drop(slog.TimeKey),
+		NoColor:           true,
+		MaxLinesPerSecond: 2,
+	}).(*Handler)
+	now := testTime
+	h.now = func() time.Time { return now }
+	l := slog.New(h)
+
+	for i := 0; i < 5; i++ {
+		l.Info("burst", "i", i)
+	}
+	now = now.Add(time.Second)
+	l.Info("after", "i", 0)
+	l.Info("after", "i", 1)
+	now = now.Add(500 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		l.Info("half", "i", i)
+	}
+	now = now.Add(500 * time.Millisecond)
+	l.Info("again")
+
+	want := "INF burst i=0\n" +
+		"INF burst i=1\n" +
+		"dropped 3 lines\n" +
+		"INF after i=0\n" +
+		"INF after i=1\n" +
+		"INF half i=0\n" +
+		"dropped 2 lines\n" +
+		"INF again\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestMarkNonMainGoroutine(t *testing.T) {
+	// tests don't run in the main goroutine, so pretend this one is it
+	defer func(id uint64) { mainGoroutine = id }(mainGoroutine)
+	mainGoroutine = goroutineID()
+
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:          drop(slog.TimeKey),
+		NoColor:              true,
+		MarkNonMainGoroutine: true,
+	}))
+
+	l.Info("main")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		l.Info("background")
+	}()
+	wg.Wait()
+	l.Info("main again")
+
+	want := "INF main\nINF [bg] background\nINF main again\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestOncePerMessage(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:        true,
+		ReplaceAttr:    drop(slog.TimeKey),
+		OncePerMessage: true,
+	}))
+
+	l.Info("loading config", "file", "a.yaml")
+	l.Info("loading config", "file", "b.yaml")
+	l.With("a", 1).Warn("loading config")
+	l.Info("ready")
+
+	want := "INF loading config file=a.yaml\n" +
+		"INF ready\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestOncePerMessageEviction(t *testing.T) {
+	var s state
+	for i := 0; i < maxOnceMessages; i++ {
+		if s.seenMessage(strconv.Itoa(i)) {
+			t.Fatalf("message %d seen before", i)
+		}
+	}
+	if !s.seenMessage("0") {
+		t.Fatal("want message 0 seen")
+	}
+
+	// evicts the oldest message "0"
+	if s.seenMessage("new") {
+		t.Fatal("message new seen before")
+	}
+	if s.seenMessage("0") {
+		t.Fatal("want message 0 evicted")
+	}
+	if !s.seenMessage("2") {
+		t.Fatal("want message 2 seen")
+	}
+}
+
+func TestFaintReset(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("\033[34m") // surrounding line color
+	l := slog.New(NewHandler(&buf, &Options{
+		AddSource:   true,
+		ReplaceAttr: drop(slog.LevelKey),
+	}))
+	l.Info("test", "a", 1, slog.Group("g", "b", 2))
+
+	got := buf.String()
+	if strings.Contains(got, ansiReset) {
+		t.Fatalf("want surrounding color preserved, got full reset in %q", got)
+	}
+	if !strings.Contains(got, "\033[2ma=\033[22m1 \033[2mg.b=\033[22m2") {
+		t.Fatalf("want faint keys ended by %q, got %q", ansiResetFaint, got)
+	}
+}
+
+func TestSummaryEvery(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:      true,
+		ReplaceAttr:  drop(slog.TimeKey),
+		SummaryEvery: 3,
+	}))
+
+	l.Info("a")
+	l.With("k", 1).Error("b")
+	l.WithGroup("g").Info("c")
+	l.Warn("d")
+	l.Debug("disabled")
+	l.Info("e")
+	l.Error("f")
+
+	want := "INF a\n" +
+		"ERR b k=1\n" +
+		"INF c\n" +
+		"…3 records: 2 INF, 1 ERR so far\n" +
+		"WRN d\n" +
+		"INF e\n" +
+		"ERR f\n" +
+		"…6 records: 3 INF, 1 WRN, 2 ERR so far\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestAddInstanceID(t *testing.T) {
+	instanceID := func(h slog.Handler) string {
+		var buf bytes.Buffer
+		h.(*Handler).w = &buf
+		if err := h.Handle(context.Background(), slog.NewRecord(time.Time{}, slog.LevelInfo, "test", 0)); err != nil {
+			t.Fatal(err)
+		}
+		id, ok := strings.CutPrefix(buf.String(), "INF inst=")
+		if !ok || len(id) < 7 || id[6] != ' ' {
+			t.Fatalf("want instance ID, got %q", buf.String())
+		}
+		return id[:6]
+	}
+
+	h1 := NewHandler(io.Discard, &Options{NoColor: true, AddInstanceID: true})
+	h2 := NewHandler(io.Discard, &Options{NoColor: true, AddInstanceID: true})
+	if id1, id2 := instanceID(h1), instanceID(h2); id1 == id2 {
+		t.Fatalf("want different IDs, got %q twice", id1)
+	}
+	if id1, id2 := instanceID(h1), instanceID(h1.WithAttrs([]slog.Attr{slog.Int("a", 1)}).WithGroup("g")); id1 != id2 {
+		t.Fatalf("want shared ID, got %q and %q", id1, id2)
+	}
+
+	h3 := NewHandler(io.Discard, &Options{NoColor: true, AddInstanceID: true, InstanceIDPerDerived: true})
+	if id1, id2 := instanceID(h3), instanceID(h3.WithGroup("g")); id1 == id2 {
+		t.Fatalf("want own ID for derived handler, got %q twice", id1)
+	}
+}
+
+func TestTimeFormatByLevel(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &Options{
+		Level:      slog.LevelDebug,
+		NoColor:    true,
+		TimeFormat: time.Kitchen,
+		TimeFormatByLevel: map[slog.Level]string{
+			slog.LevelError:    time.RFC3339,
+			slog.LevelWarn + 2: time.StampMilli,
+		},
+	})
+
+	for _, level := range []slog.Level{slog.LevelInfo, slog.LevelError, slog.LevelError + 2, slog.LevelWarn + 2} {
+		if err := h.Handle(context.Background(), slog.NewRecord(testTime, level, "test", 0)); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	for i, test := range tests {
-		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			var buf bytes.Buffer
-			if test.Opts == nil {
-				test.Opts = &Options{}
-			}
-			test.Opts.NoColor = true
-			l := slog.New(NewHandler(&buf, test.Opts))
-			test.F(l)
+	want := "12:00AM INF test\n" +
+		"2022-05-01T00:00:00Z ERR test\n" +
+		"2022-05-01T00:00:00Z ERR+2 test\n" +
+		"May  1 00:00:00.000 WRN+2 test\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
 
-			got := strings.TrimRight(buf.String(), "\n")
-			if test.Want != got {
-				t.Fatalf("(-want +got)\n- %s\n+ %s", test.Want, got)
+func TestHidePrefixGroups(t *testing.T) {
+	var buf bytes.Buffer
+	var replaced [][]string
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:          true,
+		HidePrefixGroups: []string{"otel"},
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
 			}
-		})
+			if len(groups) > 0 {
+				replaced = append(replaced, groups)
+			}
+			return a
+		},
+	}))
+
+	l.Info("test",
+		slog.Group("otel", "trace", "abc"),
+		slog.Group("http", "status", 200),
+	)
+	l.WithGroup("app").WithGroup("otel").Info("test", slog.Group("span", "id", 1))
+
+	want := "INF test trace=abc http.status=200\n" +
+		"INF test app.span.id=1\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+	if want, got := "[[otel] [http] [app otel span]]", fmt.Sprint(replaced); want != got {
+		t.Fatalf("want groups %s, got %s", want, got)
 	}
 }
 
-// drop returns a ReplaceAttr that drops the given keys.
-func drop(keys ...string) func([]string, slog.Attr) slog.Attr {
-	return func(groups []string, a slog.Attr) slog.Attr {
-		if len(groups) > 0 {
-			return a
+func TestLevelLabels(t *testing.T) {
+	labels := map[slog.Level]string{
+		slog.LevelDebug:     "debug",
+		slog.LevelInfo:      "info",
+		slog.LevelError:     "error",
+		slog.LevelError + 4: "fatal",
+	}
+	levels := []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError, slog.LevelError + 2, slog.LevelError + 4}
+
+	tests := []struct {
+		Style LevelStyle
+		Want  string
+	}{
+		{LevelStyleText, "debug info WRN error error+2 fatal "},
+		{LevelStyleFull, "debug info  WARN  error error+2 fatal "},
+	}
+	for _, test := range tests {
+		h := NewHandler(io.Discard, &Options{NoColor: true, LevelStyle: test.Style, LevelLabels: labels}).(*Handler)
+		buf := newBuffer()
+		for _, level := range levels {
+			h.appendLevel(buf, level)
+			buf.WriteChar(' ')
+		}
+		if got := string(*buf); test.Want != got {
+			t.Fatalf("(-want +got)\n- %q\n+ %q", test.Want, got)
 		}
+		buf.Free()
+	}
 
-		for _, key := range keys {
-			if a.Key == key {
-				a = slog.Attr{}
-			}
+	localized := map[slog.Level]string{
+		slog.LevelInfo:  "信息",
+		slog.LevelWarn:  "Wärn",
+		slog.LevelError: "ОШИБКА",
+	}
+	h := NewTintHandler(io.Discard, &Options{NoColor: true, LevelStyle: LevelStyleFull, LevelLabels: localized})
+	buf := newBuffer()
+	for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelWarn + 1, slog.LevelError} {
+		h.appendLevel(buf, level)
+		buf.WriteChar('|')
+	}
+	if want, got := "DEBUG|信息   |Wärn |Wärn+1|ОШИБКА|", string(*buf); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+	buf.Free()
+
+	var out bytes.Buffer
+	l := slog.New(NewHandler(&out, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		LevelLabels: labels,
+	}))
+	l.Error("test")
+	if want, got := ansiBrightRed+"error"+ansiReset+" test\n", out.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestBadgeColors(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		BadgeKeys:   []string{"on", "off"},
+	}))
+	l.Info("test", "on", true, "off", false)
+
+	want := ansiBrightGreen + "INF" + ansiReset + " test " +
+		ansiFaint + "on=" + ansiResetFaint + "[" + ansiBrightGreen + " ON" + ansiReset + "] " +
+		ansiFaint + "off=" + ansiResetFaint + "[" + ansiBrightRed + "OFF" + ansiReset + "]\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestLevelColors(t *testing.T) {
+	const blue = "\033[38;5;27m"
+
+	for _, noColor := range []bool{false, true} {
+		var buf bytes.Buffer
+		l := slog.New(NewHandler(&buf, &Options{
+			ReplaceAttr: drop(slog.TimeKey),
+			NoColor:     noColor,
+			Colors:      Colors{Warn: ansiYellow},
+			LevelColors: map[slog.Level]string{slog.LevelWarn: blue, slog.LevelWarn + 1: "\033[31m"},
+		}))
+		l.Warn("test")
+		l.Log(context.Background(), slog.LevelWarn+1, "test")
+		l.Error("test")
+
+		want := blue + "WRN" + ansiReset + " test\n" +
+			blue + "WRN+1" + ansiReset + " test\n" +
+			ansiBrightRed + "ERR" + ansiReset + " test\n"
+		if noColor {
+			want = "WRN test\nWRN+1 test\nERR test\n"
+		}
+		if got := buf.String(); want != got {
+			t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
 		}
-		return a
 	}
 }
 
-func replace(new slog.Value, keys ...string) func([]string, slog.Attr) slog.Attr {
-	return func(groups []string, a slog.Attr) slog.Attr {
-		if len(groups) > 0 {
-			return a
+func TestFlagAttr(t *testing.T) {
+	const bg = "\033[41m"
+	flag := func(groups []string, a slog.Attr) (string, bool) {
+		return bg, a.Key == "exhausted" && a.Value.Bool()
+	}
+
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		Colors:      Colors{Value: ansiCyan},
+		FlagAttr:    flag,
+	}))
+	l.Info("test", slog.Group("budget", "exhausted", true), "n", 1)
+	l.Info("test", "exhausted", false)
+
+	want := ansiBrightGreen + "INF" + ansiReset + " test " +
+		bg + ansiFaint + "budget.exhausted=" + ansiResetFaint + ansiCyan + "true" + ansiReset + " " +
+		ansiFaint + "n=" + ansiResetFaint + ansiCyan + "1" + ansiReset + "\n" +
+		ansiBrightGreen + "INF" + ansiReset + " test " +
+		ansiFaint + "exhausted=" + ansiResetFaint + ansiCyan + "false" + ansiReset + "\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	buf.Reset()
+	l = slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		NoColor:     true,
+		FlagAttr:    flag,
+	}))
+	l.Info("test", "exhausted", true)
+	if want, got := "INF test exhausted=true\n", buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestPadTime(t *testing.T) {
+	times := []time.Time{
+		time.Date(2023, time.January, 2, 9, 4, 0, 0, time.UTC),
+		time.Date(2023, time.January, 2, 12, 4, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		Opts *Options
+		Want string
+	}{
+		{
+			Opts: &Options{NoColor: true, TimeFormat: time.Kitchen, PadTime: true},
+			Want: "9:04AM  INF test\n12:04PM INF test\n",
+		},
+		{
+			Opts: &Options{NoColor: true, TimeFormat: time.Kitchen, PadTime: true, PadTimeWidth: 9},
+			Want: "9:04AM    INF test\n12:04PM   INF test\n",
+		},
+		{
+			Opts: &Options{NoColor: true, TimeFormat: time.Kitchen},
+			Want: "9:04AM INF test\n12:04PM INF test\n",
+		},
+		{
+			Opts: &Options{TimeFormat: time.Kitchen, PadTime: true, ReplaceAttr: drop(slog.LevelKey)},
+			Want: ansiFaint + "9:04AM" + ansiResetFaint + "  test\n" + ansiFaint + "12:04PM" + ansiResetFaint + " test\n",
+		},
+	}
+
+	for i, test := range tests {
+		var buf bytes.Buffer
+		h := NewHandler(&buf, test.Opts)
+		for _, tm := range times {
+			if err := h.Handle(context.Background(), slog.NewRecord(tm, slog.LevelInfo, "test", 0)); err != nil {
+				t.Fatal(err)
+			}
 		}
+		if got := buf.String(); test.Want != got {
+			t.Fatalf("%d: (-want +got)\n- %q\n+ %q", i, test.Want, got)
+		}
+	}
+}
 
-		for _, key := range keys {
-			if a.Key == key {
-				a.Value = new
+func TestPadTimeZones(t *testing.T) {
+	times := []time.Time{
+		time.Date(2023, time.January, 2, 9, 4, 0, 0, time.UTC),
+		time.Date(2023, time.January, 2, 14, 4, 0, 0, time.FixedZone("UTC+2", 2*60*60)),
+	}
+
+	tests := []struct {
+		Opts *Options
+		Want string
+	}{
+		{
+			Opts: &Options{NoColor: true, TimeFormat: "15:04Z07:00", PadTime: true},
+			Want: "09:04Z      INF test\n14:04+02:00 INF test\n",
+		},
+		{
+			Opts: &Options{NoColor: true, TimeFormat: "15:04Z07:00", PadTime: true, UTC: true},
+			Want: "09:04Z INF test\n12:04Z INF test\n",
+		},
+	}
+
+	for i, test := range tests {
+		var buf bytes.Buffer
+		h := NewHandler(&buf, test.Opts)
+		for _, tm := range times {
+			if err := h.Handle(context.Background(), slog.NewRecord(tm, slog.LevelInfo, "test", 0)); err != nil {
+				t.Fatal(err)
 			}
 		}
-		return a
+		if got := buf.String(); test.Want != got {
+			t.Fatalf("%d: (-want +got)\n- %q\n+ %q", i, test.Want, got)
+		}
 	}
 }
 
-func TestReplaceAttr(t *testing.T) {
-	tests := [][]any{
-		{},
-		{"key", "val"},
-		{"key", "val", slog.Group("group", "key2", "val2")},
-		{"key", "val", slog.Group("group", "key2", "val2", slog.Group("group2", "key3", "val3"))},
+func TestAttrDividerColor(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		AttrDivider: "|",
+	}))
+	l.Info("test", "a", 1)
+
+	want := ansiBrightGreen + "INF" + ansiReset + " test " + ansiFaint + "|" + ansiResetFaint + " " + ansiFaint + "a=" + ansiResetFaint + "1\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
 	}
+}
 
-	type replaceAttrParams struct {
-		Groups []string
-		Attr   slog.Attr
+func TestReplaceLevel(t *testing.T) {
+	clamp := func(level slog.Level) slog.Level {
+		return min(level, slog.LevelError)
 	}
 
-	replaceAttrRecorder := func(record *[]replaceAttrParams) func([]string, slog.Attr) slog.Attr {
-		return func(groups []string, a slog.Attr) slog.Attr {
-			*record = append(*record, replaceAttrParams{groups, a})
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:  drop(slog.TimeKey),
+		ReplaceLevel: clamp,
+	}))
+	l.Log(context.Background(), slog.LevelError+4, "test", "lvl", slog.LevelError+8)
+
+	want := ansiBrightRed + "ERR" + ansiReset + " test " + ansiFaint + "lvl=" + ansiResetFaint + ansiBrightRed + "ERR" + ansiReset + "\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	buf.Reset()
+	l = slog.New(NewHandler(&buf, &Options{
+		NoColor: true,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			if a.Key == slog.LevelKey {
+				a.Value = slog.AnyValue(a.Value.Any().(slog.Level) + 4)
+			}
 			return a
+		},
+		ReplaceLevel: clamp,
+	}))
+	l.Warn("test")
+	l.Error("test")
+	if want, got := "ERR test\nERR test\n", buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestLevelPipeFormat(t *testing.T) {
+	levels := []slog.Level{slog.LevelDebug - 4, slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+
+	var buf bytes.Buffer
+	h := NewHandler(&buf, &Options{
+		Level:           slog.LevelDebug - 4,
+		NoColor:         true,
+		LevelPipeFormat: true,
+	})
+	for _, level := range levels {
+		if err := h.Handle(context.Background(), slog.NewRecord(time.Time{}, level, "test", 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "TRACE | test\n" +
+		"DEBUG | test\n" +
+		"INFO  | test\n" +
+		"WARN  | test\n" +
+		"ERROR | test\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+
+	buf.Reset()
+	h = NewHandler(&buf, &Options{LevelPipeFormat: true})
+	if err := h.Handle(context.Background(), slog.NewRecord(time.Time{}, slog.LevelWarn, "test", 0)); err != nil {
+		t.Fatal(err)
+	}
+	want = ansiBrightYellow + "WARN " + ansiReset + " " + ansiBrightYellow + "|" + ansiReset + " test\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+type sourceServer struct {
+	l *slog.Logger
+}
+
+func (s sourceServer) get()     { s.l.Info("test") }
+func (s *sourceServer) handle() { s.l.Info("test") }
+
+func TestSourceFunction(t *testing.T) {
+	var buf bytes.Buffer
+	s := &sourceServer{l: slog.New(NewHandler(&buf, &Options{
+		AddSource:      true,
+		NoColor:        true,
+		ReplaceAttr:    drop(slog.TimeKey),
+		SourceFunction: true,
+	}))}
+	s.get()
+	s.handle()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for i, want := range []string{" sourceServer.get test", " (*sourceServer).handle test"} {
+		if i >= len(lines) || !strings.Contains(lines[i], "/handler_test.go:") || !strings.HasSuffix(lines[i], want) {
+			t.Fatalf("want source function %q, got %q", want, buf.String())
+		}
+	}
+
+	tests := map[string]string{
+		"main.main": "main",
+		"example.com/app/server.(*Server).handle": "(*Server).handle",
+		"example.com/app/server.Server.get":       "Server.get",
+		"gopkg.in/yaml.v3.(*decoder).unmarshal":   "(*decoder).unmarshal",
+		"example.com/app.(*Box[...]).Get":         "(*Box[...]).Get",
+		"example.com/app.Box[...].Get":            "Box[...].Get",
+		"example.com/app.run.func1":               "run.func1",
+	}
+	for fn, want := range tests {
+		if got := funcName(fn); want != got {
+			t.Fatalf("%s: want %q, got %q", fn, want, got)
 		}
 	}
+}
+
+func TestKeyWidthColor(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		KeyWidth:    3,
+	}))
+	l.Info("test", "a", 1, "abcd", 2)
+
+	want := ansiBrightGreen + "INF" + ansiReset + " test " +
+		ansiFaint + "a" + ansiResetFaint + "  " + ansiFaint + "=" + ansiResetFaint + "1 " +
+		ansiFaint + "abcd=" + ansiResetFaint + "2\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestExpandErrorsColor(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:  drop(slog.TimeKey),
+		ExpandErrors: true,
+	}))
+	l.Error("test", "err", fmt.Errorf("outer: %w", errTest))
+
+	want := "\033[91mERR\033[0m test " +
+		"\033[91;2merr=\033[22mouter\033[0m " +
+		"\033[91;2mcause=\033[22mfail\033[0m\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestAnnotateKeyTypesColor(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:      drop(slog.TimeKey),
+		AnnotateKeyTypes: true,
+		KeyWidth:         10,
+	}))
+	l.Info("test", "n", 1)
+
+	want := "\033[92mINF\033[0m test \033[2mn\033[22m\033[2m<int64>\033[22m\033[2m\033[22m  \033[2m=\033[22m1\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
 
+func TestTimeLocation(t *testing.T) {
+	tm := testTime.In(time.FixedZone("CEST", 2*60*60))
+
+	tests := []struct {
+		Opts Options
+		Want string
+	}{
+		{
+			Want: `2022-05-01T02:00:00+02:00 INF test t="2022-05-01 02:00:00 +0200 CEST"` + "\n",
+		},
+		{
+			Opts: Options{UTC: true},
+			Want: `2022-05-01T00:00:00Z INF test t="2022-05-01 00:00:00 +0000 UTC"` + "\n",
+		},
+		{
+			Opts: Options{TimeLocation: time.FixedZone("X", -60*60), UTC: true},
+			Want: `2022-04-30T23:00:00-01:00 INF test t="2022-04-30 23:00:00 -0100 X"` + "\n",
+		},
+	}
 	for i, test := range tests {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			slogRecord := make([]replaceAttrParams, 0)
-			slogLogger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{
-				ReplaceAttr: replaceAttrRecorder(&slogRecord),
-			}))
-			slogLogger.Log(context.TODO(), slog.LevelInfo, "", test...)
+			var buf bytes.Buffer
+			test.Opts.TimeFormat = time.RFC3339
+			test.Opts.NoColor = true
+			h := NewHandler(&buf, &test.Opts)
 
-			tintRecord := make([]replaceAttrParams, 0)
-			tintLogger := slog.New(NewHandler(io.Discard, &Options{
-				ReplaceAttr: replaceAttrRecorder(&tintRecord),
-			}))
-			tintLogger.Log(context.TODO(), slog.LevelInfo, "", test...)
+			r := slog.NewRecord(tm, slog.LevelInfo, "test", 0)
+			r.AddAttrs(slog.Time("t", tm))
+			if err := h.Handle(context.Background(), r); err != nil {
+				t.Fatal(err)
+			}
 
-			if !slices.EqualFunc(slogRecord, tintRecord, func(a, b replaceAttrParams) bool {
-				return slices.Equal(a.Groups, b.Groups) && a.Attr.Equal(b.Attr)
-			}) {
-				t.Fatalf("(-want +got)\n- %v\n+ %v", slogRecord, tintRecord)
+			if got := buf.String(); test.Want != got {
+				t.Fatalf("(-want +got)\n- %q\n+ %q", test.Want, got)
+			}
+		})
+	}
+}
+
+func TestDumpContextOnError(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:        drop(slog.TimeKey),
+		NoColor:            true,
+		DumpContextOnError: 3,
+	}))
+	l.Info("a")
+	l.Info("b")
+	l.With("k", "v").Info("c")
+	l.Warn("d")
+	if got := buf.String(); got != "" {
+		t.Fatalf("want records held back, got %q", got)
+	}
+
+	l.Error("e")
+	l.Info("f")
+	l.Error("g")
+	l.Error("h")
+
+	want := "INF b\nINF c k=v\nWRN d\nERR e\nINF f\nERR g\nERR h\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+// celsius is a temperature implementing fmt.Stringer and json.Marshaler
+type celsius float64
+
+func (c celsius) String() string {
+	return strconv.FormatFloat(float64(c), 'f', 1, 64) + " °C"
+}
+
+func (c celsius) MarshalJSON() ([]byte, error) {
+	return []byte(`{"celsius":` + strconv.FormatFloat(float64(c), 'f', 1, 64) + `}`), nil
+}
+
+// version implements only fmt.Stringer, with a pointer receiver
+type version struct{ major, minor int }
+
+func (v *version) String() string { return fmt.Sprintf("v%d.%d", v.major, v.minor) }
+
+// textStringer implements encoding.TextMarshaler and fmt.Stringer
+type textStringer struct{}
+
+func (textStringer) MarshalText() ([]byte, error) { return []byte("text"), nil }
+
+func (textStringer) String() string { return "string" }
+
+func TestStringerValues(t *testing.T) {
+	for _, marshalJSON := range []bool{false, true} {
+		var buf bytes.Buffer
+		l := slog.New(NewHandler(&buf, &Options{
+			ReplaceAttr: drop(slog.TimeKey),
+			NoColor:     true,
+			MarshalJSON: marshalJSON,
+		}))
+		l.Info("test", "temp", celsius(21.5), "nil", (*url.Userinfo)(nil), "both", textStringer{})
+
+		want := `INF test temp="21.5 °C" nil=<nil> both=text` + "\n"
+		if marshalJSON {
+			want = `INF test temp={"celsius":21.5} nil=<nil> both=text` + "\n"
+		}
+		if got := buf.String(); want != got {
+			t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+		}
+	}
+}
+
+func TestGoSyntaxValues(t *testing.T) {
+	type point struct{ X, Y int }
+
+	tests := []struct {
+		Opts *Options
+		Want string
+	}{
+		{
+			Opts: &Options{},
+			Want: `INF test p="{X:1 Y:2}" ids="[1 2]" g.ids=[3]` + "\n",
+		},
+		{
+			Opts: &Options{GoSyntaxValues: true},
+			Want: `INF test p="tinter.point{X:1, Y:2}" ids="[]int{1, 2}" g.ids=[]int{3}` + "\n",
+		},
+		{
+			Opts: &Options{GoSyntaxKeys: []string{"g.ids"}},
+			Want: `INF test p="{X:1 Y:2}" ids="[1 2]" g.ids=[]int{3}` + "\n",
+		},
+	}
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buf bytes.Buffer
+			test.Opts.ReplaceAttr = drop(slog.TimeKey)
+			test.Opts.NoColor = true
+			l := slog.New(NewHandler(&buf, test.Opts))
+			l.Info("test", "p", point{1, 2}, "ids", []int{1, 2}, slog.Group("g", "ids", []int{3}))
+
+			if got := buf.String(); test.Want != got {
+				t.Fatalf("(-want +got)\n- %q\n+ %q", test.Want, got)
 			}
 		})
 	}
 }
 
+func TestSystemdPrefix(t *testing.T) {
+	for _, only := range []bool{false, true} {
+		var buf bytes.Buffer
+		l := slog.New(NewHandler(&buf, &Options{
+			ReplaceAttr:       drop(slog.TimeKey),
+			NoColor:           true,
+			Level:             slog.LevelDebug - 4,
+			SystemdPrefix:     true,
+			SystemdPrefixOnly: only,
+		}))
+		l.Log(context.TODO(), slog.LevelDebug-4, "trace")
+		l.Debug("debug")
+		l.Info("info")
+		l.Log(context.TODO(), slog.LevelInfo+1, "info+1")
+		l.Warn("warn")
+		l.Error("error")
+		l.Log(context.TODO(), slog.LevelError+4, "error+4")
+
+		want := "<7>TRC trace\n<7>DBG debug\n<6>INF info\n<6>INF+1 info+1\n<4>WRN warn\n<3>ERR error\n<3>ERR+4 error+4\n"
+		if only {
+			want = "<7>trace\n<7>debug\n<6>info\n<6>info+1\n<4>warn\n<3>error\n<3>error+4\n"
+		}
+		if got := buf.String(); want != got {
+			t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+		}
+	}
+}
+
+func TestSystemdPrefixReplaceLevel(t *testing.T) {
+	for _, only := range []bool{false, true} {
+		var buf bytes.Buffer
+		l := slog.New(NewHandler(&buf, &Options{
+			ReplaceAttr:       drop(slog.TimeKey),
+			NoColor:           true,
+			SystemdPrefix:     true,
+			SystemdPrefixOnly: only,
+			ReplaceLevel: func(level slog.Level) slog.Level {
+				if level == slog.LevelInfo {
+					return slog.LevelError
+				}
+				return level
+			},
+		}))
+		l.Info("info")
+		l.Warn("warn")
+
+		want := "<3>ERR info\n<4>WRN warn\n"
+		if only {
+			want = "<3>info\n<4>warn\n"
+		}
+		if got := buf.String(); want != got {
+			t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+		}
+	}
+}
+
+// stackFrames is a stack trace like errors.StackTrace of github.com/pkg/errors
+type stackFrames []uintptr
+
+// stackError is an error carrying the stack trace of its caller
+type stackError struct{ pcs []uintptr }
+
+func (e stackError) Error() string { return "fail" }
+
+func (e stackError) StackTrace() stackFrames { return e.pcs }
+
+// newStackError returns an error with a single frame stack trace of its caller
+func newStackError() error {
+	pcs := make([]uintptr, 1)
+	runtime.Callers(2, pcs)
+	return stackError{pcs}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:     drop(slog.TimeKey),
+		NoColor:         true,
+		ErrorStackTrace: true,
+	}))
+	err := newStackError()
+	_, file, line, _ := runtime.Caller(0)
+	line-- // the line of newStackError
+	l.Info("test", "err", fmt.Errorf("wrapped: %w", err), "key", "val")
+	l.Info("test", "err", errTest)
+
+	want := fmt.Sprintf("INF test err=\"wrapped: fail\"\n%s%s:%d TestErrorStackTrace key=val\n"+
+		"INF test err=fail\n",
+		defaultIndent, filepath.Join(filepath.Base(filepath.Dir(file)), "handler_test.go"), line)
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestErrorStackTraceColor(t *testing.T) {
+	const gray = "\033[90m"
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:     drop(slog.TimeKey),
+		ErrorStackTrace: true,
+		Colors:          Colors{Faint: gray},
+	}))
+	err := newStackError()
+	_, file, line, _ := runtime.Caller(0)
+	line-- // the line of newStackError
+	l.Info("test", "err", err)
+
+	want := fmt.Sprintf("\n%s%s%s:%d TestErrorStackTraceColor\033[0m",
+		defaultIndent, gray, filepath.Join(filepath.Base(filepath.Dir(file)), "handler_test.go"), line)
+	if got := buf.String(); !strings.Contains(got, want) {
+		t.Fatalf("want %q in %q", want, got)
+	}
+}
+
 // See https://github.com/golang/exp/blob/master/slog/benchmarks/benchmarks_test.go#L25
 //
 // Run e.g.:
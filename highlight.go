@@ -0,0 +1,138 @@
+package tinter
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+// syntax highlighting formats, see Options.SyntaxHighlight
+const (
+	formatJSON = "json"
+	formatURL  = "url"
+)
+
+// appendHighlighted appends the value highlighted in the format to the buffer.
+// It returns false if the format is unknown or the value is not text, including
+// nil pointers.
+func (h *Handler) appendHighlighted(buf *buffer, v slog.Value, format string) bool {
+	var s string
+	switch {
+	case v.Kind() == slog.KindString:
+		s = v.String()
+	case v.Kind() != slog.KindAny:
+		return false
+	default:
+		switch cv := v.Any().(type) {
+		case []byte: // e.g. json.RawMessage
+			s = string(cv)
+		case fmt.Stringer: // e.g. *url.URL
+			if rv := reflect.ValueOf(cv); rv.Kind() == reflect.Pointer && rv.IsNil() {
+				return false
+			}
+			s = cv.String()
+		default:
+			return false
+		}
+	}
+
+	switch format {
+	case formatJSON:
+		highlightJSON(buf, s, h.colors.Value)
+	case formatURL:
+		highlightURL(buf, s, h.colors.Value)
+	default:
+		return false
+	}
+	return true
+}
+
+// appendToken appends a token in the color to the buffer, restoring the base
+// color after it
+func appendToken(buf *buffer, token, color, base string) {
+	if token == "" {
+		return
+	}
+	buf.WriteString(color)
+	buf.WriteString(token)
+	buf.WriteString(resetFor(color))
+	buf.WriteString(base)
+}
+
+// highlightJSON appends JSON to the buffer, with object keys in cyan, strings
+// in green, numbers in yellow and true, false and null in magenta. Invalid JSON
+// is highlighted on a best-effort basis.
+func highlightJSON(buf *buffer, s, base string) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		j := i + 1
+		switch {
+		case c == '"':
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(s)) // include the closing quote
+
+			color := ansiGreen
+			if rest := strings.TrimLeft(s[j:], " \t\r\n"); strings.HasPrefix(rest, ":") {
+				color = ansiCyan
+			}
+			appendToken(buf, s[i:j], color, base)
+		case c == '-' || '0' <= c && c <= '9':
+			for j < len(s) && strings.IndexByte("0123456789+-.eE", s[j]) >= 0 {
+				j++
+			}
+			appendToken(buf, s[i:j], ansiYellow, base)
+		case 'a' <= c && c <= 'z':
+			for j < len(s) && 'a' <= s[j] && s[j] <= 'z' {
+				j++
+			}
+			appendToken(buf, s[i:j], ansiMagenta, base)
+		default:
+			buf.WriteChar(c)
+		}
+		i = j
+	}
+}
+
+// highlightURL appends a URL to the buffer, with the scheme, separators and
+// fragment in faint, the host in cyan, query keys in yellow and query values
+// in green
+func highlightURL(buf *buffer, s, base string) {
+	if scheme, rest, ok := strings.Cut(s, "://"); ok {
+		appendToken(buf, scheme+"://", ansiFaint, base)
+		s = rest
+
+		end := strings.IndexAny(s, "/?#")
+		if end < 0 {
+			end = len(s)
+		}
+		appendToken(buf, s[:end], ansiCyan, base)
+		s = s[end:]
+	}
+
+	s, fragment, hasFragment := strings.Cut(s, "#")
+	path, query, hasQuery := strings.Cut(s, "?")
+	buf.WriteString(path)
+	if hasQuery {
+		appendToken(buf, "?", ansiFaint, base)
+		for i, param := range strings.Split(query, "&") {
+			if i > 0 {
+				appendToken(buf, "&", ansiFaint, base)
+			}
+			key, value, hasValue := strings.Cut(param, "=")
+			appendToken(buf, key, ansiYellow, base)
+			if hasValue {
+				appendToken(buf, "=", ansiFaint, base)
+				appendToken(buf, value, ansiGreen, base)
+			}
+		}
+	}
+	if hasFragment {
+		appendToken(buf, "#"+fragment, ansiFaint, base)
+	}
+}
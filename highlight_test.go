@@ -0,0 +1,57 @@
+package tinter
+
+import (
+	"bytes"
+	"log/slog"
+	"net/url"
+	"testing"
+)
+
+func TestSyntaxHighlight(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:     drop(slog.TimeKey, slog.LevelKey),
+		SyntaxHighlight: map[string]string{"body": "json", "req.url": "url"},
+	}))
+
+	u, _ := url.Parse("https://example.com/path?q=a&n=1#top")
+	l.Info("test", "body", `{"a": 1.5, "b": ["x", true, null]}`, slog.Group("req", "url", u))
+
+	want := "test \033[2mbody=\033[22m" +
+		"{\033[36m\"a\"\033[0m: \033[33m1.5\033[0m, \033[36m\"b\"\033[0m: [\033[32m\"x\"\033[0m, \033[35mtrue\033[0m, \033[35mnull\033[0m]} " +
+		"\033[2mreq.url=\033[22m" +
+		"\033[2mhttps://\033[22m\033[36mexample.com\033[0m/path" +
+		"\033[2m?\033[22m\033[33mq\033[0m\033[2m=\033[22m\033[32ma\033[0m\033[2m&\033[22m\033[33mn\033[0m\033[2m=\033[22m\033[32m1\033[0m\033[2m#top\033[22m\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestSyntaxHighlightNilURL(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:     drop(slog.TimeKey, slog.LevelKey),
+		SyntaxHighlight: map[string]string{"u": "url"},
+	}))
+	l.Info("test", "u", (*url.URL)(nil))
+
+	want := "test \033[2mu=\033[22m<nil>\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestSyntaxHighlightNoColor(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:         true,
+		ReplaceAttr:     drop(slog.TimeKey, slog.LevelKey),
+		SyntaxHighlight: map[string]string{"body": "json", "n": "json"},
+	}))
+	l.Info("test", "body", `{"a": 1}`, "n", 1)
+
+	want := `test body="{\"a\": 1}" n=1` + "\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
@@ -0,0 +1,137 @@
+package tinter
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// CSS classes of the elements of HTML output, see Options.HTMLOutput
+const (
+	htmlTime = iota
+	htmlDebug
+	htmlInfo
+	htmlWarn
+	htmlError
+	htmlMessage
+	htmlKey
+	htmlValue
+	htmlSource
+	htmlErrorKey
+	htmlErrorValue
+	htmlFaint
+)
+
+// htmlClasses maps the elements of HTML output to their CSS classes
+var htmlClasses = [...]string{
+	htmlTime:       "tinter-time",
+	htmlDebug:      "tinter-debug",
+	htmlInfo:       "tinter-info",
+	htmlWarn:       "tinter-warn",
+	htmlError:      "tinter-error",
+	htmlMessage:    "tinter-msg",
+	htmlKey:        "tinter-key",
+	htmlValue:      "tinter-value",
+	htmlSource:     "tinter-source",
+	htmlErrorKey:   "tinter-error-key",
+	htmlErrorValue: "tinter-error-value",
+	htmlFaint:      "tinter-faint",
+}
+
+// htmlMarkerBase is the SGR parameter of the first element marker. Markers
+// are private SGR sequences, so they are handled like colors until they are
+// replaced by spans in toHTML.
+const htmlMarkerBase = 900
+
+// htmlMarker returns the marker of an element
+func htmlMarker(element int) string {
+	return "\033[" + strconv.Itoa(htmlMarkerBase+element) + "m"
+}
+
+// setHTMLColors sets the colors of the handler to the element markers
+func (h *Handler) setHTMLColors() {
+	h.colors = Colors{
+		Time:     htmlMarker(htmlTime),
+		Debug:    htmlMarker(htmlDebug),
+		Info:     htmlMarker(htmlInfo),
+		Warn:     htmlMarker(htmlWarn),
+		Error:    htmlMarker(htmlError),
+		Message:  htmlMarker(htmlMessage),
+		Key:      htmlMarker(htmlKey),
+		Value:    htmlMarker(htmlValue),
+		Source:   htmlMarker(htmlSource),
+		ErrorKey: htmlMarker(htmlErrorKey),
+
+		// end the error key span and start the error value span
+		ErrorValue: ansiResetFaint + htmlMarker(htmlErrorValue),
+
+		Faint: htmlMarker(htmlFaint),
+	}
+	h.levelColors = [numBands]string{h.colors.Faint, h.colors.Debug, h.colors.Info, h.colors.Warn, h.colors.Error}
+}
+
+// toHTML converts the buffer from start to HTML, replacing element markers by
+// <span> elements and escaping all text. A full reset closes all open spans,
+// a faint reset closes the innermost one. Other escape sequences are dropped.
+func toHTML(buf *buffer, start int) {
+	line := newBuffer()
+	defer line.Free()
+	*line = append(*line, (*buf)[start:]...)
+	*buf = (*buf)[:start]
+
+	// keep the space terminating the line last
+	trailingSpace := len(*line) > 0 && (*line)[len(*line)-1] == ' '
+	if trailingSpace {
+		*line = (*line)[:len(*line)-1]
+	}
+
+	open := 0
+	s := string(*line)
+	for len(s) > 0 {
+		i := strings.Index(s, "\033[")
+		if i < 0 {
+			buf.WriteString(html.EscapeString(s))
+			break
+		}
+		buf.WriteString(html.EscapeString(s[:i]))
+		s = s[i+2:]
+
+		// find the final byte of the escape sequence
+		end := strings.IndexFunc(s, func(r rune) bool { return r >= 0x40 && r <= 0x7e })
+		if end < 0 {
+			break
+		}
+		params, final := s[:end], s[end]
+		s = s[end+1:]
+		if final != 'm' {
+			continue
+		}
+
+		switch params {
+		case "", "0":
+			for ; open > 0; open-- {
+				buf.WriteString("</span>")
+			}
+		case "22":
+			if open > 0 {
+				buf.WriteString("</span>")
+				open--
+			}
+		default:
+			n, err := strconv.Atoi(params)
+			if err != nil || n < htmlMarkerBase || n >= htmlMarkerBase+len(htmlClasses) {
+				continue
+			}
+			buf.WriteString(`<span class="`)
+			buf.WriteString(htmlClasses[n-htmlMarkerBase])
+			buf.WriteString(`">`)
+			open++
+		}
+	}
+	for ; open > 0; open-- {
+		buf.WriteString("</span>")
+	}
+	if trailingSpace {
+		buf.WriteChar(' ')
+	}
+}
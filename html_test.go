@@ -0,0 +1,41 @@
+package tinter
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+func TestHTMLOutput(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr: drop(slog.TimeKey),
+		HTMLOutput:  true,
+	}))
+	l.Info("a <b>", "html", `<script>"&"</script>`, "err", errTest)
+	l.Debug("disabled")
+	l.Warn("warn")
+
+	want := `<span class="tinter-info">INF</span> <span class="tinter-msg">a &lt;b&gt;</span> ` +
+		`<span class="tinter-key">html=</span><span class="tinter-value">&#34;&lt;script&gt;\&#34;&amp;\&#34;&lt;/script&gt;&#34;</span> ` +
+		`<span class="tinter-error-key">err=</span><span class="tinter-error-value">fail</span>` + "\n" +
+		`<span class="tinter-warn">WRN</span> <span class="tinter-msg">warn</span>` + "\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestHTMLOutputNoColor(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:     true,
+		ReplaceAttr: drop(slog.TimeKey),
+		HTMLOutput:  true,
+	}))
+	l.Info("test", "a", "<b>")
+
+	want := "INF test a=&lt;b&gt;\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
@@ -0,0 +1,41 @@
+package tinter
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Flusher is implemented by handlers that hold back output and can write it
+// on demand, e.g. [Handler] with Options.BufferWrites.
+type Flusher interface {
+	Flush() error
+}
+
+// FlushOnPanic recovers a panic, logs the panic value with h as an error
+// record with the message "panic" and the attribute "panic", flushes h if it's
+// a [Flusher] and panics again with the same value. It does nothing if the
+// goroutine is not panicking. It must be deferred directly, typically at the
+// start of main:
+//
+//	h := tinter.NewHandler(os.Stderr, nil)
+//	defer tinter.FlushOnPanic(h)
+//
+// As the panic is logged as an error, records held back by
+// Options.DumpContextOnError are written before it. Records already sent by a
+// [ChannelHandler] are not waited for, as they are written by the receiver of
+// its channel.
+func FlushOnPanic(h slog.Handler) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	r := slog.NewRecord(time.Now(), slog.LevelError, "panic", 0)
+	r.AddAttrs(slog.Any("panic", v))
+	_ = h.Handle(context.Background(), r)
+	if f, ok := h.(Flusher); ok {
+		_ = f.Flush()
+	}
+	panic(v)
+}
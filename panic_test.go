@@ -0,0 +1,60 @@
+package tinter
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+// flushHandler is a handler recording whether it was flushed
+type flushHandler struct {
+	slog.Handler
+	flushed bool
+}
+
+func (h *flushHandler) Flush() error {
+	h.flushed = true
+	return nil
+}
+
+func TestFlushOnPanic(t *testing.T) {
+	var buf bytes.Buffer
+	h := &flushHandler{Handler: NewHandler(&buf, &Options{
+		ReplaceAttr:        drop(slog.TimeKey),
+		NoColor:            true,
+		DumpContextOnError: 2,
+	})}
+
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Fatalf("want panic %q, got %v", "boom", v)
+			}
+		}()
+		defer FlushOnPanic(h)
+
+		slog.New(h).Info("starting")
+		panic("boom")
+	}()
+
+	want := "INF starting\nERR panic panic=boom\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+	if !h.flushed {
+		t.Fatal("want handler flushed")
+	}
+}
+
+func TestFlushOnPanicNoPanic(t *testing.T) {
+	var buf bytes.Buffer
+	h := &flushHandler{Handler: NewHandler(&buf, nil)}
+
+	func() {
+		defer FlushOnPanic(h)
+	}()
+
+	if buf.Len() != 0 || h.flushed {
+		t.Fatalf("want nothing logged or flushed, got %q", buf.String())
+	}
+}
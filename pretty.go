@@ -0,0 +1,137 @@
+package tinter
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// isPretty returns true if the value is pretty-printed with Options.PrettyStructs,
+// i.e. it is a struct, map, slice or array, or a pointer to one of them. Byte
+// slices and arrays like hashes and IDs are not.
+func isPretty(v any) bool {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct, reflect.Map:
+		return true
+	case reflect.Slice, reflect.Array:
+		return rv.Type().Elem().Kind() != reflect.Uint8
+	default:
+		return false
+	}
+}
+
+// appendPretty appends a value to the buffer, with the fields and elements of
+// structs, maps, slices and arrays on their own lines, indented by depth.
+// Pointers visited on the path to the value are rendered as "<cycle>", values
+// nested deeper than the maximum depth as "…".
+func (h *Handler) appendPretty(buf *buffer, v reflect.Value, depth int, visited map[uintptr]bool) {
+	if !v.IsValid() {
+		buf.WriteString("<nil>")
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("<nil>")
+			return
+		}
+	}
+	if v.CanInterface() {
+		switch cv := v.Interface().(type) {
+		case error:
+			*buf = strconv.AppendQuote(*buf, cv.Error())
+			return
+		case fmt.Stringer:
+			*buf = strconv.AppendQuote(*buf, cv.String())
+			return
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if ptr := v.Pointer(); visited[ptr] {
+			buf.WriteString("<cycle>")
+			return
+		} else if v.Kind() != reflect.Slice || v.Len() > 0 {
+			visited[ptr] = true
+			defer delete(visited, ptr)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		buf.WriteChar('&')
+		h.appendPretty(buf, v.Elem(), depth, visited)
+	case reflect.Interface:
+		h.appendPretty(buf, v.Elem(), depth, visited)
+	case reflect.Struct:
+		h.appendPrettyOpen(buf, '{', v.NumField(), depth, func(i int) {
+			buf.WriteString(v.Type().Field(i).Name)
+			buf.WriteString(": ")
+			h.appendPretty(buf, v.Field(i), depth+1, visited)
+		})
+		buf.WriteChar('}')
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		h.appendPrettyOpen(buf, '{', len(keys), depth, func(i int) {
+			h.appendPretty(buf, keys[i], depth+1, visited)
+			buf.WriteString(": ")
+			h.appendPretty(buf, v.MapIndex(keys[i]), depth+1, visited)
+		})
+		buf.WriteChar('}')
+	case reflect.Slice, reflect.Array:
+		h.appendPrettyOpen(buf, '[', v.Len(), depth, func(i int) {
+			h.appendPretty(buf, v.Index(i), depth+1, visited)
+		})
+		buf.WriteChar(']')
+	case reflect.String:
+		*buf = strconv.AppendQuote(*buf, v.String())
+	case reflect.Bool:
+		*buf = strconv.AppendBool(*buf, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		*buf = strconv.AppendInt(*buf, v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		*buf = strconv.AppendUint(*buf, v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		*buf = strconv.AppendFloat(*buf, v.Float(), 'g', -1, v.Type().Bits())
+	default:
+		buf.WriteString(fmt.Sprint(v))
+	}
+}
+
+// appendPrettyOpen appends the opening bracket of a container and its n
+// elements, each on its own line, followed by the indentation of the closing
+// bracket, which is appended by the caller
+func (h *Handler) appendPrettyOpen(buf *buffer, bracket byte, n, depth int, appendElem func(i int)) {
+	buf.WriteChar(bracket)
+	if n == 0 {
+		return
+	}
+	if h.prettyMaxDepth > 0 && depth >= h.prettyMaxDepth {
+		buf.WriteString("…")
+		return
+	}
+
+	for i := 0; i < n; i++ {
+		h.appendPrettyIndent(buf, depth+1)
+		appendElem(i)
+	}
+	h.appendPrettyIndent(buf, depth)
+}
+
+// appendPrettyIndent appends a newline indented by depth to the buffer
+func (h *Handler) appendPrettyIndent(buf *buffer, depth int) {
+	buf.WriteChar('\n')
+	for i := 0; i < depth; i++ {
+		buf.WriteString(h.indent)
+	}
+}
@@ -0,0 +1,135 @@
+package tinter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type prettyNode struct {
+	Name string
+	Tags []string
+	Meta map[string]int
+	Next *prettyNode
+}
+
+// prettyPoint is a struct implementing fmt.Stringer
+type prettyPoint struct{ X, Y int }
+
+func (p prettyPoint) String() string {
+	return fmt.Sprintf("(%d,%d)", p.X, p.Y)
+}
+
+func TestPrettyStructs(t *testing.T) {
+	n := &prettyNode{Name: "a", Tags: []string{"x", "y"}, Meta: map[string]int{"k": 1, "j": 2}}
+	n.Next = &prettyNode{Name: "b", Next: n}
+
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:       true,
+		ReplaceAttr:   drop(slog.TimeKey),
+		PrettyStructs: true,
+	}))
+	l.Info("test", "node", n, "n", 1)
+
+	want := `INF test node=&{
+  Name: "a"
+  Tags: [
+    "x"
+    "y"
+  ]
+  Meta: {
+    "j": 2
+    "k": 1
+  }
+  Next: &{
+    Name: "b"
+    Tags: <nil>
+    Meta: <nil>
+    Next: <cycle>
+  }
+} n=1
+`
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %s\n+ %s", want, got)
+	}
+}
+
+func TestPrettyStructsMaxDepth(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:               true,
+		ReplaceAttr:           drop(slog.TimeKey),
+		PrettyStructs:         true,
+		PrettyStructsMaxDepth: 1,
+		Indent:                "\t",
+	}))
+	l.Info("test", "v", struct {
+		A    []int
+		B    []int
+		Err  error
+		Time time.Time
+	}{A: []int{1}, Err: errors.New("fail"), Time: time.Date(2022, 11, 10, 23, 0, 0, 0, time.UTC)})
+
+	want := "INF test v={\n" +
+		"\tA: […]\n" +
+		"\tB: <nil>\n" +
+		"\tErr: \"fail\"\n" +
+		"\tTime: \"2022-11-10 23:00:00 +0000 UTC\"\n" +
+		"}\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestPrettyStructsPlainValues(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:       true,
+		ReplaceAttr:   drop(slog.TimeKey),
+		PrettyStructs: true,
+	}))
+	type id []byte
+	l.Info("test", "hash", [4]byte{1, 2, 3, 4}, "id", id{5, 6}, "p", prettyPoint{1, 2}, "pp", &prettyPoint{3, 4})
+
+	want := `INF test hash="[1 2 3 4]" id="[5 6]" p=(1,2) pp=(3,4)` + "\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestPrettyStructsFloats(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		NoColor:       true,
+		ReplaceAttr:   drop(slog.TimeKey),
+		PrettyStructs: true,
+	}))
+	l.Info("test", "v", struct {
+		A float32
+		B float64
+	}{0.1, 0.1})
+
+	want := "INF test v={\n  A: 0.1\n  B: 0.1\n}\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
+
+func TestPrettyStructsLnav(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewHandler(&buf, &Options{
+		ReplaceAttr:    drop(slog.TimeKey),
+		PrettyStructs:  true,
+		LnavCompatible: true,
+	}))
+	l.Info("test", "v", struct{ A, B int }{1, 2})
+
+	want := `INFO  test v="{A:1 B:2}"` + "\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("(-want +got)\n- %q\n+ %q", want, got)
+	}
+}
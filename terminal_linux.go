@@ -0,0 +1,5 @@
+package tinter
+
+import "syscall"
+
+const ioctlReadTermios = syscall.TCGETS
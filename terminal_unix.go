@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package tinter
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// isatty returns true if f is a terminal, i.e. its terminal attributes can be
+// read
+func isatty(f *os.File) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), ioctlReadTermios, uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
@@ -0,0 +1,12 @@
+package tinter
+
+import (
+	"os"
+	"syscall"
+)
+
+// isatty returns true if f is a console
+func isatty(f *os.File) bool {
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(f.Fd()), &mode) == nil
+}
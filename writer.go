@@ -0,0 +1,28 @@
+package tinter
+
+import "sync/atomic"
+
+// CountingWriter is an [io.Writer] that discards all data written to it and
+// counts the number of bytes instead. It can be used with [NewHandler] to
+// estimate the log volume without writing any logs.
+//
+// It is safe for concurrent use.
+type CountingWriter struct {
+	n atomic.Int64
+}
+
+// NewCountingWriter returns a new [CountingWriter].
+func NewCountingWriter() *CountingWriter {
+	return new(CountingWriter)
+}
+
+// Write counts the bytes of p and discards them
+func (w *CountingWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// Count returns the number of bytes written
+func (w *CountingWriter) Count() int64 {
+	return w.n.Load()
+}
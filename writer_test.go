@@ -0,0 +1,21 @@
+package tinter
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestCountingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	cw := NewCountingWriter()
+
+	l := slog.New(NewHandler(io.MultiWriter(&buf, cw), nil))
+	l.Info("test", "key", "val")
+	l.Error("test", "err", errTest)
+
+	if want, got := int64(buf.Len()), cw.Count(); want != got {
+		t.Fatalf("want %d bytes, got %d", want, got)
+	}
+}